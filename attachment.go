@@ -79,6 +79,10 @@ func encodeAttachmentValue(v reflect.Value, index *int) []io.Reader {
 		}
 		fallthrough
 	case reflect.Array:
+		if isScalar(v.Type().Elem().Kind()) {
+			// such as []byte, no need to look at each element
+			return ret
+		}
 		for i, n := 0, v.Len(); i < n; i++ {
 			var r []io.Reader
 			r = encodeAttachmentValue(v.Index(i), index)
@@ -90,6 +94,18 @@ func encodeAttachmentValue(v reflect.Value, index *int) []io.Reader {
 	return ret
 }
 
+// isScalar reports whether values of kind k hold no attachment.
+func isScalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
 func decodeAttachments(v interface{}, binary [][]byte) error {
 	return decodeAttachmentValue(reflect.ValueOf(v), binary)
 }
@@ -0,0 +1,42 @@
+package socketio_client
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// BasicAuth holds the credentials of HTTP basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// header returns the headers of the requests of the named transport, with
+// the Authorization of Options.BasicAuth, or else of the userinfo of the
+// url, unless Options.Header sets one.
+func (c *clientConn) header(name string) http.Header {
+	header := transportHeader(c.options, name)
+	if header.Get("Authorization") != "" {
+		return header
+	}
+	auth := c.options.BasicAuth
+	if auth == nil && c.url.User != nil {
+		password, _ := c.url.User.Password()
+		auth = &BasicAuth{Username: c.url.User.Username(), Password: password}
+	}
+	if auth != nil {
+		r := http.Request{Header: header}
+		r.SetBasicAuth(auth.Username, auth.Password)
+	}
+	return header
+}
+
+// redactURL returns u without its password, for logs.
+func redactURL(u *url.URL) *url.URL {
+	if _, ok := u.User.Password(); !ok {
+		return u
+	}
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return &redacted
+}
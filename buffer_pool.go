@@ -0,0 +1,67 @@
+package socketio_client
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is left to the
+// garbage collector rather than pooled, so one large message does not pin
+// its memory.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool recycles the buffers messages are read into and packets are
+// encoded in, instead of allocating them for each packet.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(b)
+}
+
+// pooledReader reads a message held in a pooled buffer, put back in the
+// pool on Close.
+type pooledReader struct {
+	buf *bytes.Buffer
+}
+
+func (r *pooledReader) Read(p []byte) (int, error) {
+	if r.buf == nil {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
+
+func (r *pooledReader) Close() error {
+	if r.buf != nil {
+		putBuffer(r.buf)
+		r.buf = nil
+	}
+	return nil
+}
+
+// readAll is ioutil.ReadAll reading through a pooled buffer, so the
+// returned slice is the only allocation.
+func readAll(r io.Reader) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	ret := make([]byte, buf.Len())
+	copy(ret, buf.Bytes())
+	return ret, nil
+}
@@ -1,16 +1,33 @@
 package socketio_client
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 )
 
+var rawArgsType = reflect.TypeOf([]json.RawMessage(nil))
+
 type caller struct {
 	sync.RWMutex
 	Func reflect.Value
 	Args []reflect.Type
+	ctx  bool //Func takes a context.Context before Args
+
+	variadic bool  //the last of Args is the slice of a ...T parameter
+	raw      bool  //Func takes all the arguments undecoded as one []json.RawMessage
+	codec    Codec //decodes the arguments of an ack callback, see Client.SetCodec
+	pattern  bool  //registered with OnPattern or OnMatch, gets the event name in its context
+	priority int   //see Client.OnPriority
+	seq      int   //order of registration among the handlers of an event
+
+	end     func(err error) //called once an ack callback ran or failed, see Options.TraceEmit
+	timer   *time.Timer     //fails the ack callback once the ack timeout is over
+	retried bool            //its event is sent again until acknowledged, see Options.Retry
 }
 
 func newCaller(f interface{}) (*caller, error) {
@@ -24,23 +41,51 @@ func newCaller(f interface{}) (*caller, error) {
 			Func: fv,
 		}, nil
 	}
-	args := make([]reflect.Type, ft.NumIn())
-	for i, n := 0, ft.NumIn(); i < n; i++ {
-		args[i] = ft.In(i)
+	first := 0
+	if ft.In(0) == contextType {
+		first = 1
+	}
+	args := make([]reflect.Type, ft.NumIn()-first)
+	for i := range args {
+		args[i] = ft.In(first + i)
 	}
 
 	return &caller{
-		Func: fv,
-		Args: args,
+		Func:     fv,
+		Args:     args,
+		ctx:      first == 1,
+		variadic: ft.IsVariadic(),
+		raw:      len(args) == 1 && args[0] == rawArgsType,
 	}, nil
 }
 
-func (c *caller) GetArgs() []interface{} {
+// argType returns the type of the i-th argument passed to Func.
+func (c *caller) argType(i int) reflect.Type {
+	if last := len(c.Args) - 1; c.variadic && i >= last {
+		return c.Args[last].Elem()
+	}
+	return c.Args[i]
+}
+
+// GetArgs returns pointers to the zero values of the arguments of Func,
+// for n arguments received when Func is variadic.
+func (c *caller) GetArgs(n int) []interface{} {
 	c.RLock()
 	defer c.RUnlock()
 
-	ret := make([]interface{}, len(c.Args))
-	for i, argT := range c.Args {
+	count := len(c.Args)
+	if c.raw {
+		return []interface{}{new([]json.RawMessage)}
+	}
+	if c.variadic {
+		count = n
+		if count < len(c.Args)-1 {
+			count = len(c.Args) - 1
+		}
+	}
+	ret := make([]interface{}, count)
+	for i := range ret {
+		argT := c.argType(i)
 		if argT.Kind() == reflect.Ptr {
 			argT = argT.Elem()
 		}
@@ -50,28 +95,33 @@ func (c *caller) GetArgs() []interface{} {
 	return ret
 }
 
-func (c *caller) Call(args []interface{}) []reflect.Value {
+// Call calls Func with args, preceded by ctx when Func takes a context.
+func (c *caller) Call(ctx context.Context, args []interface{}) []reflect.Value {
 	c.RLock()
 	defer c.RUnlock()
 	var a []reflect.Value
 	diff := 0
 
+	if c.variadic && len(args) < len(c.Args)-1 || !c.variadic && len(args) != len(c.Args) {
+		return []reflect.Value{reflect.ValueOf([]interface{}{}), reflect.ValueOf(errors.New("Arguments do not match"))}
+	}
+
 	a = make([]reflect.Value, len(args))
 	for i, arg := range args {
+		argT := c.argType(i)
 		v := reflect.ValueOf(arg)
-		if c.Args[i].Kind() != reflect.Ptr {
+		if argT.Kind() != reflect.Ptr {
 			if v.IsValid() {
 				v = v.Elem()
 			} else {
-				v = reflect.Zero(c.Args[i])
+				v = reflect.Zero(argT)
 			}
 		}
 		a[i+diff] = v
 	}
 
-	if len(args) != len(c.Args) {
-		return []reflect.Value{reflect.ValueOf([]interface{}{}), reflect.ValueOf(errors.New("Arguments do not match"))}
+	if c.ctx {
+		a = append([]reflect.Value{reflect.ValueOf(ctx)}, a...)
 	}
-
 	return c.Func.Call(a)
 }
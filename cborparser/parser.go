@@ -0,0 +1,93 @@
+// Package cborparser encodes socket.io packets in CBOR, for servers using a
+// CBOR custom parser. Each packet is a CBOR map of the type, nsp, id and
+// data of the packet, as with socket.io-msgpack-parser.
+//
+//	opts := &socketio_client.Options{
+//		Parser: cborparser.Parser{},
+//	}
+//	client, err := socketio_client.NewClient(uri, opts)
+package cborparser
+
+import (
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+var decMode, _ = cbor.DecOptions{
+	// decode objects into interface{} arguments as JSON does
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+type outgoing struct {
+	Type int           `cbor:"type"`
+	Nsp  string        `cbor:"nsp"`
+	Id   *int          `cbor:"id,omitempty"`
+	Data []interface{} `cbor:"data,omitempty"`
+}
+
+type incoming struct {
+	Type int               `cbor:"type"`
+	Nsp  string            `cbor:"nsp"`
+	Id   *int              `cbor:"id"`
+	Data []cbor.RawMessage `cbor:"data"`
+}
+
+// Parser is a socketio_client.Parser encoding packets in CBOR. Arguments
+// are encoded like encoding/json does, following the json tags of structs,
+// []byte values being CBOR byte strings.
+type Parser struct{}
+
+func (Parser) Encode(p socketio_client.Packet) ([]byte, error) {
+	v := outgoing{
+		Type: int(p.Type),
+		Nsp:  namespace(p.NSP),
+	}
+	if p.Id >= 0 {
+		id := p.Id
+		v.Id = &id
+	}
+	v.Data, _ = p.Data.([]interface{})
+	return cbor.Marshal(v)
+}
+
+func (Parser) Decode(message []byte) (socketio_client.Packet, [][]byte, error) {
+	var v incoming
+	if err := decMode.Unmarshal(message, &v); err != nil {
+		return socketio_client.Packet{}, nil, err
+	}
+	p := socketio_client.Packet{
+		Type: socketio_client.PacketType(v.Type),
+		NSP:  v.Nsp,
+		Id:   -1,
+	}
+	if p.NSP == "/" {
+		p.NSP = ""
+	}
+	if v.Id != nil {
+		p.Id = *v.Id
+	}
+	var data [][]byte
+	if v.Data != nil {
+		data = make([][]byte, len(v.Data))
+		for i, d := range v.Data {
+			data[i] = d
+		}
+	}
+	return p, data, nil
+}
+
+func (Parser) Unmarshal(data []byte, v interface{}) error {
+	return decMode.Unmarshal(data, v)
+}
+
+// namespace returns the namespace as written on the wire, where the default
+// one is "/".
+func namespace(nsp string) string {
+	if nsp == "" {
+		return "/"
+	}
+	return nsp
+}
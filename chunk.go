@@ -0,0 +1,222 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ChunkEvent is the event carrying the chunks of events split by Chunking.
+const ChunkEvent = "socketio:chunk"
+
+// chunkRoom is what is left in each chunk for the packet around its data.
+const chunkRoom = 1024
+
+// Chunking splits the arguments of events too long for the server into
+// chunks, so they get through proxies strict about message sizes, and puts
+// together events chunked the same way by the server.
+//
+// The JSON array of the arguments is cut into count slices, each sent as a
+// ChunkEvent with two arguments: a ChunkHeader then the slice as binary
+// data. The last chunk carries the ack id of the event, the receiver
+// handling the whole event once all its chunks arrived, acking it if asked
+// to. Events with binary arguments, which include those with a codec or
+// encrypted, are never chunked.
+//
+// Events put together are at most the maxPayload advertised by the server
+// or Options.MaxPayload long, and the chunks waiting for the rest of their
+// events at most MaxBuffered bytes; chunks over either limit are rejected
+// with ErrPayloadTooLarge, dropping their event.
+type Chunking struct {
+	Size        int           //bytes of arguments per chunk, the maxPayload advertised by the server or Options.MaxPayload, less 1KB, by default
+	Timeout     time.Duration //how long the chunks of an event wait for the others before being dropped, 1m by default
+	MaxBuffered int64         //bytes of chunks waiting for the rest of their events at most, 64MB by default
+}
+
+func (c *Chunking) maxBuffered() int64 {
+	if c.MaxBuffered <= 0 {
+		return 64 << 20
+	}
+	return c.MaxBuffered
+}
+
+// ChunkHeader is the first argument of a ChunkEvent.
+type ChunkHeader struct {
+	ID    int64  `json:"id"`    // same for all the chunks of an event
+	Event string `json:"event"` // name of the chunked event
+	Index int    `json:"index"` // from 0
+	Count int    `json:"count"`
+}
+
+type chunkedEvent struct {
+	parts  [][]byte
+	missed int
+	size   int64 //bytes of the parts received
+	timer  *time.Timer
+}
+
+type chunkState struct {
+	lastID   int64
+	lock     sync.Mutex
+	events   map[int64]*chunkedEvent
+	buffered int64 //bytes of the parts of all the events
+}
+
+// maxPayload returns the longest message the server and Options.MaxPayload
+// allow, 0 when unlimited.
+func (client *Client) maxPayload() int64 {
+	max := int64(client.opts.MaxPayload)
+	if conn, _ := client.manager.connection(); conn != nil && conn.handshake != nil {
+		if hs := conn.handshake.MaxPayload; hs > 0 && (max <= 0 || hs < max) {
+			max = hs
+		}
+	}
+	return max
+}
+
+// chunkSize returns the longest arguments sent unchunked, 0 when unlimited.
+func (client *Client) chunkSize() int {
+	if size := client.opts.Chunking.Size; size > 0 {
+		return size
+	}
+	max := client.maxPayload()
+	if max <= chunkRoom {
+		return int(max)
+	}
+	return int(max - chunkRoom)
+}
+
+// chunk returns the packets of the chunks of args when they are too long
+// to be sent at once, nil otherwise.
+func (client *Client) chunk(event string, args []interface{}) ([][]interface{}, error) {
+	if client.opts.Chunking == nil {
+		return nil, nil
+	}
+	size := client.chunkSize()
+	if size <= 0 || len(encodeAttachments(args)) > 0 {
+		return nil, nil
+	}
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) <= size {
+		return nil, nil
+	}
+	header := ChunkHeader{
+		ID:    atomic.AddInt64(&client.chunks.lastID, 1),
+		Event: event,
+		Count: (len(payload) + size - 1) / size,
+	}
+	ret := make([][]interface{}, header.Count)
+	for i := range ret {
+		header.Index = i
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		data := &Attachment{Data: bytes.NewBuffer(payload[i*size : end])}
+		ret[i] = []interface{}{ChunkEvent, header, data}
+	}
+	return ret, nil
+}
+
+// onChunk stores the chunk decoded by d and returns a decoder of the whole
+// event once it is the last one missing, nil before.
+func (client *Client) onChunk(d *decoder, packet *Packet) (*decoder, error) {
+	var header ChunkHeader
+	data := new(Attachment)
+	if err := decodeArgs(d, packet, nil, []interface{}{&header, data}); err != nil {
+		return nil, err
+	}
+	if header.Count <= 0 || header.Index < 0 || header.Index >= header.Count {
+		return nil, fmt.Errorf("chunk %d of %d", header.Index, header.Count)
+	}
+	maxSize, maxCount := client.chunkLimits()
+	if header.Count > maxCount {
+		return nil, fmt.Errorf("%w: event of %d chunks, at most %d", ErrPayloadTooLarge, header.Count, maxCount)
+	}
+	part := []byte{}
+	if data.Data != nil {
+		var err error
+		if part, err = ioutil.ReadAll(data.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &client.chunks
+	s.lock.Lock()
+	e, ok := s.events[header.ID]
+	if !ok {
+		if s.events == nil {
+			s.events = make(map[int64]*chunkedEvent)
+		}
+		e = &chunkedEvent{
+			parts:  make([][]byte, header.Count),
+			missed: header.Count,
+		}
+		timeout := client.opts.Chunking.Timeout
+		if timeout <= 0 {
+			timeout = time.Minute
+		}
+		id := header.ID
+		e.timer = time.AfterFunc(timeout, labeled(client.opts, func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if s.events[id] == e {
+				s.drop(id, e)
+			}
+		}, "chunkTimeout", "socketio.namespace", client.Namespace()))
+		s.events[header.ID] = e
+	}
+	if len(e.parts) != header.Count {
+		s.lock.Unlock()
+		return nil, fmt.Errorf("chunk %d of %d of an event of %d chunks", header.Index, header.Count, len(e.parts))
+	}
+	if e.parts[header.Index] == nil {
+		size := int64(len(part))
+		if e.size+size > maxSize || s.buffered+size > client.opts.Chunking.maxBuffered() {
+			s.drop(header.ID, e)
+			s.lock.Unlock()
+			return nil, fmt.Errorf("%w: chunk %d of event %d over %d bytes, or %d buffered", ErrPayloadTooLarge, header.Index, header.ID, maxSize, client.opts.Chunking.maxBuffered())
+		}
+		e.parts[header.Index] = part
+		e.missed--
+		e.size += size
+		s.buffered += size
+	}
+	if e.missed > 0 {
+		s.lock.Unlock()
+		return nil, nil
+	}
+	s.drop(header.ID, e)
+	s.lock.Unlock()
+
+	return client.argsDecoder(header.Event, bytes.Join(e.parts, nil))
+}
+
+// chunkLimits returns the longest event put together from chunks and the
+// most chunks it may be cut into.
+func (client *Client) chunkLimits() (maxSize int64, maxCount int) {
+	maxSize = client.maxPayload()
+	if buffered := client.opts.Chunking.maxBuffered(); maxSize <= 0 || maxSize > buffered {
+		maxSize = buffered
+	}
+	size := int64(client.chunkSize())
+	if size <= 0 {
+		// unlimited payloads leave the chunk size to the server
+		size = chunkRoom
+	}
+	return maxSize, int((maxSize + size - 1) / size)
+}
+
+// drop forgets the chunks of the event id. s.lock must be held.
+func (s *chunkState) drop(id int64, e *chunkedEvent) {
+	delete(s.events, id)
+	s.buffered -= e.size
+	e.timer.Stop()
+}
@@ -0,0 +1,108 @@
+package socketio_client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// chunkFrames returns the frames of the chunk index of count of the event
+// id, carrying part.
+func chunkFrames(id, index, count int, part []byte) []MemoryFrame {
+	header := fmt.Sprintf(`451-["%s",{"id":%d,"event":"big","index":%d,"count":%d},{"_placeholder":true,"num":0}]`, ChunkEvent, id, index, count)
+	return []MemoryFrame{
+		{Data: []byte(header)},
+		{Binary: true, Data: append([]byte{4}, part...)},
+	}
+}
+
+// chunkClient connects a client with opts to a server sending frames once
+// the client emits "start", and returns the client with the errors of its
+// chunks.
+func chunkClient(t *testing.T, opts *Options, frames []MemoryFrame) (*Client, chan error) {
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		if !bytes.HasPrefix(f.Data, []byte(`42["start"`)) {
+			return false
+		}
+		for _, f := range frames {
+			if conn.WriteFrame(f) != nil {
+				break
+			}
+		}
+		return true
+	})
+	errs := make(chan error, len(frames))
+	opts.Transport = []string{"memory"}
+	opts.OnDecodeError = func(event string, raw []byte, err error) {
+		errs <- err
+	}
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, errs
+}
+
+func TestChunksPutTogether(t *testing.T) {
+	payload := []byte(`["hello, world"]`)
+	var frames []MemoryFrame
+	for i := 0; i < 4; i++ {
+		frames = append(frames, chunkFrames(1, i, 4, payload[i*4:(i+1)*4])...)
+	}
+	client, errs := chunkClient(t, &Options{Chunking: &Chunking{Size: 4}}, frames)
+	got := make(chan string, 1)
+	client.On("big", func(s string) {
+		got <- s
+	})
+	client.Emit("start")
+	select {
+	case s := <-got:
+		if s != "hello, world" {
+			t.Fatalf("got %q", s)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
+
+func TestChunksTooLarge(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		frames []MemoryFrame
+	}{{
+		name:   "count",
+		opts:   Options{MaxPayload: 200, Chunking: &Chunking{Size: 10}},
+		frames: chunkFrames(1, 0, 1<<30, []byte("[")),
+	}, {
+		name: "size",
+		opts: Options{MaxPayload: 200, Chunking: &Chunking{Size: 10}},
+		frames: append(chunkFrames(1, 0, 4, bytes.Repeat([]byte("x"), 150)),
+			chunkFrames(1, 1, 4, bytes.Repeat([]byte("x"), 150))...),
+	}, {
+		name: "buffered",
+		opts: Options{Chunking: &Chunking{Size: 10, MaxBuffered: 100}},
+		frames: append(chunkFrames(1, 0, 2, bytes.Repeat([]byte("x"), 60)),
+			chunkFrames(2, 0, 2, bytes.Repeat([]byte("x"), 60))...),
+	}}
+	for _, tt := range tests {
+		opts, frames := tt.opts, tt.frames
+		t.Run(tt.name, func(t *testing.T) {
+			client, errs := chunkClient(t, &opts, frames)
+			client.Emit("start")
+			select {
+			case err := <-errs:
+				if !errors.Is(err, ErrPayloadTooLarge) {
+					t.Fatalf("error = %v, want ErrPayloadTooLarge", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("chunks accepted")
+			}
+		})
+	}
+}
@@ -1,80 +1,346 @@
 package socketio_client
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"path"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Options struct {
-	Transport []string            //protocol name string,websocket polling...
-	Query     map[string]string //url的附加的参数
-	Header    map[string][]string
+	Transport   []string          //protocol name string,websocket polling... or a name given to RegisterTransport
+	Query       map[string]string //url的附加的参数
+	QueryValues url.Values        //extra query parameters, repeated keys allowed; parameters in the uri keep their order
+	QueryFunc   func() url.Values //called before every connection attempt for parameters such as nonces or rotating tokens
+	Header      map[string][]string
+	BasicAuth   *BasicAuth             //credentials sent in the Authorization header of every request, in place of those in the userinfo of the uri
+	TokenSource func() (string, error) //called before every request for a token sent as Authorization: Bearer, taking over BasicAuth; a rotated token is picked up by the next request or reconnect, an error fails the request
+	Namespace   string                 //namespace to join, such as "/chat"; empty joins the default namespace
+	Linger      time.Duration          //how long an unused connection stays open for other namespaces to reuse
+	Context     context.Context        //canceling it closes the connection and stops reconnecting; also the parent of the handler contexts
+
+	FallbackURLs   []string       //servers tried when the uri of NewClient cannot be connected to, on connect and reconnect
+	FallbackPolicy EndpointPolicy //order in which the servers are tried, EndpointOrdered by default
+	SRV            *SRVLookup     //looks the servers up in DNS SRV records on every connection attempt, replacing the host of the uri
+
+	ConnectTimeout time.Duration //bounds NewClient as a whole: the dials of all the urls, the open handshake and the answer to the namespace CONNECT, failing with ErrConnectTimeout; also bounds each reconnect attempt; 0 waits forever
+	ReadTimeout    time.Duration //drops the connection when no packet arrives for this long, which must exceed the ping interval; 0 waits forever
+	WriteTimeout   time.Duration //drops the connection when a packet takes longer to send; 0 waits forever
+
+	Dialer      *net.Dialer                                                       //dials the TCP connections of both transports, e.g. to tune KeepAlive; the net/http defaults when nil
+	Resolver    *net.Resolver                                                     //resolves the server host name for both transports, replacing the Resolver of Dialer
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error) //dials the TCP connections of both transports instead of Dialer, e.g. to pin addresses
+
+	PollingHeader   map[string][]string //headers of the polling requests, overriding the same keys of Header
+	WebsocketHeader map[string][]string //headers of the websocket upgrade request, overriding the same keys of Header
+	HTTP2           HTTP2Mode           //when the polling transport speaks HTTP/2, HTTP2Auto by default
+	Redirect        RedirectPolicy      //which redirects of the polling requests are followed, RedirectFollow by default; permanent ones also move the session and the upgrade to the new url
+	Origin          string              //Origin header of the websocket upgrade and the polling requests, for servers checking it; overrides the headers above
+	Jar             http.CookieJar      //keeps cookies set by the server, such as load balancer affinity; one per connection by default
+	AffinityHeaders []string            //response headers, such as a node id set by a load balancer with sticky sessions, sent back on the later polling requests and the websocket upgrade
+	Compression     *Compression        //negotiates permessage-deflate on the websocket transport; nil disables it
+
+	TLSConfig   *tls.Config    //TLS settings of both transports, such as client certificates; cloned for each connection
+	ServerName  string         //name sent in SNI and checked against the server certificate instead of the host of the uri, e.g. when dialing an IP address
+	Host        string         //Host header of the requests instead of the host of the uri, e.g. behind a fronting domain
+	RootCAs     *x509.CertPool //CAs the server certificate is checked against instead of the system ones
+	RootCAsFile string         //PEM file of CAs used instead of RootCAs, read again on connecting whenever it changed
+
+	InsecureSkipVerify bool //accept any server certificate on both transports, for development against self-signed servers only; logged as an error on every connection, to the standard logger without a Logger
+
+	DisableUpgrade bool                   //stay on polling even when the server offers websocket
+	UpgradeWait    time.Duration          //how long writes wait for an upgrade in progress, 1.5s by default
+	UpgradeTimeout time.Duration          //how long the upgrade probe may go unanswered before the connection stays on polling, 10s by default
+	OnUpgrade      func(transport string) //called once the connection moved to transport, such as "websocket"
+	OnUpgradeError func(err error)        //called with ErrUpgradeFailed when the websocket could not be opened or its probe failed; the connection stays on polling
+
+	TraceHandler     func(info HandlerInfo) func(err error)                  //called before each event handler; the returned func gets its result
+	TraceEmit        func(info EmitInfo) func(err error)                     //called on each emit; the returned func gets the result once sent, or acked when an ack callback is given
+	OnHandlerPanic   func(event string, recovered interface{}, stack []byte) //called when a handler panicked; the panic is recovered and logged either way
+	OnDecodeError    func(event string, raw []byte, err error)               //called when the arguments of an event don't fit its handler, which is skipped; raw is the JSON array of the packet
+	OnUnhandledEvent func(event string, raw []byte)                          //called for each event without a handler, raw being the JSON array of the packet
+	Encrypt          func(event string, plain []byte) ([]byte, error)        //seals the JSON array of the arguments of each event emitted, which travels as one binary attachment; not for events with a codec
+	Decrypt          func(event string, sealed []byte) ([]byte, error)       //opens the arguments of each event received, sealed by the Encrypt of the sender, before the handler runs
+	StrictEvents     bool                                                    //log events without a handler as errors and fail their handling with ErrUnhandledEvent, like a handler error
+
+	Dispatch        DispatchMode //how handlers of events and acks run, DispatchSerial by default
+	DispatchWorkers int          //goroutines of DispatchPool, GOMAXPROCS by default
+
+	IncomingBuffer     int                //messages read ahead of their handling, so pings are answered while handlers are slow; 64 by default
+	IncomingPolicy     IncomingPolicy     //what to do with a message arriving while the buffer is full, IncomingBlock by default
+	OnIncomingOverflow func(err error)    //called with ErrIncomingOverflow for each message dropped or on closing
+	MaxPayload         int                //longest message in bytes, emitted or received; longer emits fail and longer messages close the connection, with ErrPayloadTooLarge; 0 is unlimited
+	IncomingRateLimit  *IncomingRateLimit //limits how fast events from the server reach their handlers, see IncomingRateLimit
+	Chunking           *Chunking          //splits emits longer than the server accepts into chunks and puts together events received in chunks, see Chunking
+
+	Reconnection              bool                            //reconnect automatically after the connection is lost
+	ReconnectionAttempts      int                             //attempts before giving up, 0 means unlimited
+	ReconnectionDelay         time.Duration                   //initial delay between attempts, 1s by default
+	ReconnectionDelayMax      time.Duration                   //maximum delay between attempts, 5s by default
+	ResourceExhaustedDelay    time.Duration                   //delay after running out of file descriptors, 10s by default, doubled while it lasts
+	ResourceExhaustedDelayMax time.Duration                   //maximum delay after running out of file descriptors, 2m by default
+	OnReconnectAttempt        func(a *ReconnectAttempt) error //called before each reconnect attempt to change its url, headers or query, such as to refresh a token; an error fails the attempt
+	ResumeSession             bool                            //on reconnecting, first try to take over the engine.io session of a polling transport lost within pingInterval+pingTimeout, without a namespace CONNECT; websocket sessions end with their transport
+	BufferEmits               bool                            //queue emits while reconnecting and send them once connected again
+	Outbox                    Outbox                          //where buffered emits are queued, in memory by default; enables buffering when set
+
+	HandshakeCache *HandshakeCache //shares server advertised settings with other clients of the same origin
+	Limiter        *Limiter        //caps concurrent handshakes and open connections, DefaultLimiter when nil
+	WriteCoalesce  time.Duration   //delay during which consecutive writes are sent together, in one syscall on websocket and one POST on polling, e.g. 2ms; 0 disables
+	ForceBase64    bool            //polling exchanges binary packets base64 encoded, for servers or proxies that cannot carry binary bodies
+	GzipThreshold  int             //gzip polling POST bodies of at least this many bytes, for servers accepting it; 0 never does
+
+	DisableTimestamps bool   //drop the cache-busting timestamp of the polling requests
+	TimestampParam    string //query parameter of the polling timestamp, "t" by default
+
+	StrictProtocol      bool                               //drop the connection on any packet breaking the protocol
+	OnProtocolViolation func(violation *ProtocolViolation) //called with each violation in strict mode
+
+	JSONUseNumber             bool   //decode numbers into interface{} arguments as json.Number instead of float64, keeping large integers exact
+	JSONDisallowUnknownFields bool   //fail decoding arguments holding object keys their struct has no field for
+	Parser                    Parser //wire format of the packets for servers using a custom parser, such as cborparser.Parser; JSON by default
+	EngineOnly                bool   //talk to a plain engine.io server, at /engine.io/ unless the uri has a path: the "message" handler gets the raw messages and Send writes them, Emit failing with ErrEngineOnly
+
+	Retry         *RetryPolicy  //retries emits with an ack callback until acknowledged
+	AckTimeout    time.Duration //fails ack callbacks with ErrAckTimeout when no ack arrives in time, see EmitTimeout; 0 waits forever
+	EmitRateLimit *RateLimit    //spreads out emits of the namespace, so a burst does not trip the flood protection of the server
+	Sampler       *Sampler      //passes a sample of event payloads to a callback
+
+	GoroutineLabels bool              //set pprof labels (socketio.role, socketio.sid...) on the goroutines of the client
+	Labels          map[string]string //extra pprof labels added when GoroutineLabels is set
+
+	Tracer   Tracer    //sees every socket.io packet sent or received, for debugging protocol issues
+	Record   *Recorder //writes every engine.io packet sent or received with its time, to replay the session with a Replayer
+	Logger   Logger    //receives internal log messages, which are discarded by default
+	LogLevel LogLevel  //passes only messages up to this level to Logger, or to the standard logger without one
 }
 
 type Client struct {
 	opts *Options
 
-	conn *clientConn
+	manager *manager
+
+	eventsLock    sync.RWMutex
+	events        map[string]*caller
+	codecs        map[string]Codec
+	patterns      []patternHandler
+	priorities    map[string][]*caller //handlers added with OnPriority, in the order they run
+	handlerSeq    int
+	chunks        chunkState
+	emitBucket    *tokenBucket
+	incomingLimit *incomingLimiter
+	acksLock      sync.RWMutex
+	acks          map[int]*caller
+	idLock        sync.Mutex
+	id            int
+	namespace     string
+	connectLock   sync.Mutex
+	connectAck    chan error //waits for the server to answer the namespace CONNECT of NewClient
+
+	middlewareLock sync.RWMutex
+	outgoing       []Middleware
+	incoming       []Middleware
 
-	eventsLock sync.RWMutex
-	events     map[string]*caller
-	acksLock   sync.RWMutex
-	acks       map[int]*caller
-	idLock     sync.Mutex
-	id         int
-	namespace  string
+	bufferLock sync.Mutex
+	stats      statsCounters
+	outbox     Outbox
+	flushQueue memoryOutbox //events emitted while the outboxes are flushed, without an outbox of their own
+
+	ctxLock sync.Mutex
+	ctx     context.Context //passed to handlers, canceled on disconnect
+	cancel  context.CancelFunc
 }
 
+// NewClient connects to the socket.io server at uri, joining
+// opts.Namespace. A nil opts connects with the default options.
+//
+// Clients of other namespaces of uri share the connection when their
+// options only differ in the settings of the namespace, such as AckTimeout
+// or the trace hooks. Funcs cannot be compared: options setting one that
+// applies to the connection, such as TokenSource or DialContext, only share
+// it when the same *Options is passed.
 func NewClient(uri string, opts *Options) (client *Client, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.EngineOnly && strings.TrimSuffix(opts.Namespace, "/") != "" {
+		return nil, fmt.Errorf("%w: no namespace %q", ErrEngineOnly, opts.Namespace)
+	}
+	toURL := socketURL
+	if opts.EngineOnly {
+		toURL = engineURL
+	}
+	urls := make([]*url.URL, 0, 1+len(opts.FallbackURLs))
+	for _, raw := range append([]string{uri}, opts.FallbackURLs...) {
+		u, err := toURL(raw, opts)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+
+	client = &Client{
+		opts: opts,
+
+		events:     make(map[string]*caller),
+		codecs:     make(map[string]Codec),
+		priorities: make(map[string][]*caller),
+		acks:       make(map[int]*caller),
+		namespace:  strings.TrimSuffix(opts.Namespace, "/"),
+		outbox:     opts.Outbox,
+
+		emitBucket:    newTokenBucket(opts.EmitRateLimit),
+		incomingLimit: newIncomingLimiter(opts.IncomingRateLimit),
+	}
+	if client.outbox == nil && opts.BufferEmits {
+		client.outbox = &memoryOutbox{}
+	}
+
+	var deadline time.Time
+	if opts.ConnectTimeout > 0 {
+		deadline = time.Now().Add(opts.ConnectTimeout)
+	}
+	if _, err = acquireManager(urls, opts, client, deadline); err != nil {
+		return nil, err
+	}
+	if client.namespace != "" {
+		if err = client.connectBefore(deadline); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if client.outbox != nil {
+		client.flushOutbox()
+	}
+
+	return
+}
+
+// socketURL returns the engine.io url of the server at uri.
+func socketURL(uri string, opts *Options) (*url.URL, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
-		return
+		return nil, err
 	}
 	u.Path = path.Join("/socket.io", u.Path)
 	u.Path = u.EscapedPath()
 	if strings.HasSuffix(u.Path, "socket.io") {
 		u.Path += "/"
 	}
-	q := u.Query()
-	q.Set("EIO", "3")
+	query := url.Values{"EIO": {"3"}}
 	for k, v := range opts.Query {
-		q.Set(k, v)
+		query.Set(k, v)
 	}
-	u.RawQuery = q.Encode()
+	u.RawQuery = mergeQuery(mergeQuery(u.RawQuery, query), opts.QueryValues)
+	return u, nil
+}
 
-	socket, err := newClientConn(opts, u)
-	if err != nil {
-		return
+// Namespace returns the namespace the client joined, "/" for the default one.
+func (client *Client) Namespace() string {
+	if client.namespace == "" {
+		return "/"
 	}
+	return client.namespace
+}
 
-	client = &Client{
-		opts: opts,
-		conn: socket,
+// CurrentTransport returns the name of the transport in use, "polling" or
+// "websocket".
+func (client *Client) CurrentTransport() string {
+	conn, _ := client.manager.connection()
+	return conn.transportName()
+}
 
-		events: make(map[string]*caller),
-		acks:   make(map[int]*caller),
-	}
+// Connected reports whether the connection is currently up.
+func (client *Client) Connected() bool {
+	return client.manager.connected(client)
+}
 
-	go client.readLoop()
+// Reconnects returns how many times the connection was re-established.
+func (client *Client) Reconnects() int {
+	return client.manager.reconnectCount()
+}
 
-	return
+// LastResponse returns the HTTP response to the latest open handshake of
+// the connection, including failed reconnect attempts. Failures of NewClient
+// carry theirs in a *HandshakeError.
+func (client *Client) LastResponse() *HandshakeResponse {
+	return client.manager.lastResponse()
 }
 
+// On registers f as the handler of message. f may take a context.Context
+// first, which is canceled once the connection is lost or the client closed.
+// Arguments of type json.RawMessage are passed undecoded, and f taking a
+// single []json.RawMessage gets all the arguments undecoded.
 func (client *Client) On(message string, f interface{}) error {
 	c, err := newCaller(f)
 	if err != nil {
 		return err
 	}
 	client.eventsLock.Lock()
+	c.seq = client.nextSeqLocked()
 	client.events[message] = c
 	client.eventsLock.Unlock()
 	return nil
 }
 
+// RegisterHandlers registers each exported method of svc as the handler of
+// the event named after it with its first letter lowered, so that the
+// method KeepaliveRsp handles "keepaliveRsp".
+func (client *Client) RegisterHandlers(svc interface{}) error {
+	v := reflect.ValueOf(svc)
+	t := v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		event := strings.ToLower(name[:1]) + name[1:]
+		if err := client.On(event, v.Method(i).Interface()); err != nil {
+			return fmt.Errorf("method %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Emit sends an event to the server, with an ack callback as the last
+// argument when one is wanted. Events emitted from one goroutine reach the
+// server in call order across every namespace sharing the connection,
+// including across a transport upgrade and, when each namespace buffers
+// emits, across a reconnect. An ack callback taking an error last gets the
+// error the connection was lost with, unless the event is retried, see
+// Options.Retry.
 func (client *Client) Emit(message string, args ...interface{}) (err error) {
+	return client.emit(nil, client.opts.AckTimeout, message, args)
+}
+
+// EmitContext is Emit within ctx, which Options.TraceEmit gets, such as to
+// join the trace of the caller, and the outgoing middleware as
+// Packet.Context. Writing the event gives up once ctx is done.
+func (client *Client) EmitContext(ctx context.Context, message string, args ...interface{}) error {
+	return client.emit(ctx, client.opts.AckTimeout, message, args)
+}
+
+// EmitTimeout is Emit with an ack timeout overriding Options.AckTimeout; 0
+// waits for the ack forever.
+func (client *Client) EmitTimeout(timeout time.Duration, message string, args ...interface{}) error {
+	return client.emit(nil, timeout, message, args)
+}
+
+// emit sends the event within ctx, which is nil for none.
+func (client *Client) emit(ctx context.Context, timeout time.Duration, message string, args []interface{}) (err error) {
+	if client.opts.EngineOnly {
+		return ErrEngineOnly
+	}
+	if err := client.limitEmit(); err != nil {
+		return err
+	}
 	var c *caller
 	if l := len(args); l > 0 {
 		fv := reflect.ValueOf(args[l-1])
@@ -87,37 +353,165 @@ func (client *Client) Emit(message string, args ...interface{}) (err error) {
 			args = args[:l-1]
 		}
 	}
-	args = append([]interface{}{message}, args...)
+	// arguments from EmitPreencoded are written as is
+	var pre bool
+	if len(args) == 1 {
+		_, pre = args[0].(preencoded)
+	}
+	if codec := client.codec(message); codec != nil && !pre {
+		if args, err = encodeArgs(codec, args); err != nil {
+			return err
+		}
+		if c != nil {
+			c.codec = codec
+		}
+	} else if client.opts.Encrypt != nil && !pre {
+		if args, err = client.sealArgs(message, args); err != nil {
+			return err
+		}
+	}
+	var chunks [][]interface{}
+	if !pre {
+		if chunks, err = client.chunk(message, args); err != nil {
+			return err
+		}
+	}
+	if len(chunks) > 0 {
+		for _, chunk := range chunks[:len(chunks)-1] {
+			if err := client.send(ctx, chunk); err != nil {
+				return err
+			}
+		}
+		// the last chunk carries the ack id
+		args = chunks[len(chunks)-1]
+	} else {
+		args = append([]interface{}{message}, args...)
+	}
+	var end func(err error)
+	if trace := client.opts.TraceEmit; trace != nil {
+		payload, _ := json.Marshal(args)
+		info := EmitInfo{
+			Context:    ctx,
+			Event:      message,
+			Namespace:  client.Namespace(),
+			Size:       len(payload),
+			Ack:        c != nil,
+			setContext: func(traced context.Context) { ctx = traced },
+		}
+		if info.Context == nil {
+			info.Context = context.Background()
+		}
+		end = trace(info)
+	}
 	if c != nil {
 		client.acksLock.Lock()
 		defer client.acksLock.Unlock()
-		id, err := client.sendId(args)
+		id, err := client.sendId(ctx, args)
 		if err != nil {
+			if end != nil {
+				end(err)
+			}
 			return err
 		}
+		c.end = end
 		client.acks[id] = c
+		if timeout > 0 {
+			c.timer = time.AfterFunc(timeout, labeled(client.opts, func() {
+				client.expireAck(id, c)
+			}, "ackTimeout", "socketio.namespace", client.Namespace()))
+		}
+		if policy := client.opts.Retry; policy != nil && policy.Retries > 0 && len(encodeAttachments(args)) == 0 {
+			c.retried = true
+			go client.retry(ctx, id, args, policy)
+		}
 		return nil
 	}
-	return client.send(args)
+	err = client.send(ctx, args)
+	if end != nil {
+		end(err)
+	}
+	return err
 }
 
 func (client *Client) sendConnect() error {
-	packet := packet{
+	packet := Packet{
 		Type: _CONNECT,
 		Id:   -1,
 		NSP:  client.namespace,
 	}
-	encoder := newEncoder(client.conn)
-	return encoder.Encode(packet)
+	return client.sendPacket(packet)
 }
 
-func (client *Client) sendId(args []interface{}) (int, error) {
+// connectBefore sends the namespace CONNECT and waits for the server to
+// answer it, giving up at deadline unless it is zero. A CONNECT still
+// waiting for the connection then is not sent.
+func (client *Client) connectBefore(deadline time.Time) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
+	defer cancel()
+	acked := make(chan error, 1)
+	client.connectLock.Lock()
+	client.connectAck = acked
+	client.connectLock.Unlock()
+	defer func() {
+		client.connectLock.Lock()
+		client.connectAck = nil
+		client.connectLock.Unlock()
+	}()
+
+	sent := make(chan error, 1)
+	go labeled(client.opts, func() {
+		sent <- client.sendPacket(Packet{
+			Type: _CONNECT,
+			Id:   -1,
+			NSP:  client.namespace,
+			ctx:  ctx,
+		})
+	}, "connect", "socketio.namespace", client.Namespace())()
+	for {
+		select {
+		case err := <-sent:
+			if err != nil && ctx.Err() == nil {
+				return err
+			}
+			sent = nil
+		case err := <-acked:
+			return err
+		case <-client.manager.done:
+			return client.manager.closeErr()
+		case <-ctx.Done():
+			return connectTimeout(client.opts)
+		}
+	}
+}
+
+// ackConnect hands the answer of the server to the namespace CONNECT of
+// NewClient, a packet of type t, to connectBefore.
+func (client *Client) ackConnect(t PacketType) {
+	client.connectLock.Lock()
+	acked := client.connectAck
+	client.connectAck = nil
+	client.connectLock.Unlock()
+	if acked == nil {
+		return
+	}
+	if t == _ERROR {
+		acked <- fmt.Errorf("%w: %s", ErrNamespaceRefused, client.namespace)
+		return
+	}
+	acked <- nil
+}
+
+func (client *Client) sendId(ctx context.Context, args []interface{}) (int, error) {
 	client.idLock.Lock()
-	packet := packet{
+	packet := Packet{
 		Type: _EVENT,
 		Id:   client.id,
 		NSP:  client.namespace,
 		Data: args,
+		ctx:  ctx,
 	}
 	client.id++
 	if client.id < 0 {
@@ -125,26 +519,27 @@ func (client *Client) sendId(args []interface{}) (int, error) {
 	}
 	client.idLock.Unlock()
 
-	encoder := newEncoder(client.conn)
-	err := encoder.Encode(packet)
-	if err != nil {
-		return -1, nil
+	if err := client.sendPacket(packet); err != nil {
+		return -1, err
 	}
 	return packet.Id, nil
 }
 
-func (client *Client) send(args []interface{}) error {
-	packet := packet{
+func (client *Client) send(ctx context.Context, args []interface{}) error {
+	packet := Packet{
 		Type: _EVENT,
 		Id:   -1,
 		NSP:  client.namespace,
 		Data: args,
+		ctx:  ctx,
 	}
-	encoder := newEncoder(client.conn)
-	return encoder.Encode(packet)
+	return client.sendPacket(packet)
 }
 
-func (client *Client) onPacket(decoder *decoder, packet *packet) ([]interface{}, error) {
+func (client *Client) onPacket(decoder *decoder, packet *Packet) (ret []interface{}, err error) {
+	if packet.ctx == nil {
+		packet.ctx = client.handlerContext()
+	}
 	var message string
 	switch packet.Type {
 	case _CONNECT:
@@ -160,27 +555,112 @@ func (client *Client) onPacket(decoder *decoder, packet *packet) ([]interface{},
 	default:
 		message = decoder.Message()
 	}
-	client.eventsLock.RLock()
-	c, ok := client.events[message]
-	client.eventsLock.RUnlock()
-	if !ok {
-		// If the message is not recognized by the server, the decoder.currentCloser
-		// needs to be closed otherwise the server will be stuck until the e
+	if message == ChunkEvent && client.opts.Chunking != nil && decoder != nil {
+		whole, err := client.onChunk(decoder, packet)
+		if err != nil {
+			if f := client.opts.OnDecodeError; f != nil {
+				f(message, decoder.payload(), err)
+				return nil, nil
+			}
+			return nil, err
+		}
+		if whole == nil {
+			// more chunks to come
+			return nil, nil
+		}
+		message, decoder = whole.message, whole
+	}
+	var c *caller
+	var ok bool
+	if packet.Type == _EVENT || packet.Type == _BINARY_EVENT {
+		c, ok = client.handler(message)
+	} else {
+		client.eventsLock.RLock()
+		c, ok = client.events[message]
+		client.eventsLock.RUnlock()
+	}
+	extra := client.priorityHandlers(message)
+	if !ok && len(extra) == 0 {
+		if packet.Type == _EVENT || packet.Type == _BINARY_EVENT {
+			err = client.onUnhandledEvent(message, decoder)
+		}
 		decoder.Close()
-		return nil, nil
+		return nil, err
+	}
+	var panicked error
+	if trace := client.opts.TraceHandler; trace != nil {
+		info := HandlerInfo{
+			Context:    packet.Context(),
+			Event:      message,
+			Namespace:  client.Namespace(),
+			Size:       decoder.Size(),
+			setContext: func(ctx context.Context) { packet.ctx = ctx },
+		}
+		if end := trace(info); end != nil {
+			defer func() {
+				if panicked != nil {
+					end(panicked)
+				} else {
+					end(err)
+				}
+			}()
+		}
+	}
+	// only events are sealed, not the payloads of connect and error
+	sealed := packet.Type == _EVENT || packet.Type == _BINARY_EVENT
+	if sealed && decoder != nil && client.opts.Decrypt != nil && client.codec(message) == nil {
+		open, err := client.openArgs(message, decoder, packet)
+		if err != nil {
+			if f := client.opts.OnDecodeError; f != nil {
+				f(message, decoder.payload(), err)
+				return nil, nil
+			}
+			return nil, err
+		}
+		decoder = open
+	}
+	if len(extra) == 0 {
+		ret, panicked, err = client.call(message, c, decoder, packet)
+		return ret, err
+	}
+	for _, h := range prioritized(c, extra) {
+		// decoding closes the decoder, each handler gets its own
+		d, p := decoder, *packet
+		if decoder != nil {
+			clone := *decoder
+			d = &clone
+		}
+		ret, panicked, err = client.call(message, h, d, &p)
+		if errors.Is(err, ErrSkipHandlers) {
+			return ret, nil
+		}
+		if err != nil || panicked != nil {
+			break
+		}
 	}
-	args := c.GetArgs()
+	return ret, err
+}
+
+// call decodes the arguments of the event for c and runs it, returning the
+// values to ack with and the error c returned, or how it panicked.
+func (client *Client) call(message string, c *caller, decoder *decoder, packet *Packet) (ret []interface{}, panicked, err error) {
+	args := c.GetArgs(decoder.argCount())
 	olen := len(args)
-	if decoder != nil && olen > 0 {
-		packet.Data = &args
-		if err := decoder.DecodeData(packet); err != nil {
-			args = c.GetArgs()
+	if decoder != nil && c.raw {
+		args[0] = decoder.rawArgs()
+	} else if decoder != nil && olen > 0 {
+		if err := decodeArgs(decoder, packet, client.codec(message), args); err != nil {
+			args = c.GetArgs(0)
 			lastIdx := len(args) - 1
 			if lastIdx < 0 {
-				return nil, err
+				return nil, nil, err
 			}
-			if !c.Args[lastIdx].Implements(reflect.TypeOf((*error)(nil)).Elem()) {
-				return nil, err
+			if !c.Args[lastIdx].Implements(errorType) {
+				if f := client.opts.OnDecodeError; f != nil {
+					f(message, decoder.payload(), err)
+					return nil, nil, nil
+				}
+				return nil, nil, err
 			}
 			args[lastIdx] = &err
 		} else {
@@ -189,90 +669,305 @@ func (client *Client) onPacket(decoder *decoder, packet *packet) ([]interface{},
 			}
 		}
 	}
-	retV := c.Call(args)
+	retV, panicked := client.invoke(packet.ctx, message, c, args)
 	if len(retV) == 0 {
-		return nil, nil
+		return nil, panicked, nil
 	}
 
-	var err error
 	if last, ok := retV[len(retV)-1].Interface().(error); ok {
 		err = last
 		retV = retV[0 : len(retV)-1]
 	}
-	ret := make([]interface{}, len(retV))
+	ret = make([]interface{}, len(retV))
 	for i, v := range retV {
 		ret[i] = v.Interface()
 	}
-	return ret, err
+	return ret, nil, err
 }
 
-func (client *Client) onAck(id int, decoder *decoder, packet *packet) error {
-	client.acksLock.RLock()
+func (client *Client) onAck(id int, decoder *decoder, packet *Packet) error {
+	// looked up and removed at once, the ack timeout or a second ack for
+	// the same id finding nothing left to call
+	client.acksLock.Lock()
 	c, ok := client.acks[id]
-	client.acksLock.RUnlock()
+	if ok {
+		delete(client.acks, id)
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	}
+	client.acksLock.Unlock()
 	if !ok {
-		decoder.Close() //Emit the closechan, or Conn ReadLoop will stuck on this reader and closechan pass
+		decoder.Close()
 		return nil
 	}
-	client.acksLock.Lock()
-	delete(client.acks, id)
-	client.acksLock.Unlock()
 
-	args := c.GetArgs()
-	packet.Data = &args
-	if err := decoder.DecodeData(packet); err != nil {
+	args := c.GetArgs(decoder.argCount())
+	if c.raw {
+		args[0] = decoder.rawArgs()
+	} else if err := decodeArgs(decoder, packet, c.codec, args); err != nil {
+		client.failAck(c, err)
 		return err
 	}
-	c.Call(args)
+	client.invoke(packet.ctx, "ack", c, args)
+	if c.end != nil {
+		c.end(nil)
+	}
 	return nil
 }
 
-func (client *Client) readLoop() error {
-	defer func() {
-		p := packet{
-			Type: _DISCONNECT,
-			Id:   -1,
+func (client *Client) handlePacket(decoder *decoder, p *Packet) error {
+	client.stats.count(statsReceived, p.Type, decoder.Message(), decoder.wireSize())
+	if !client.limitIncoming(decoder, p) {
+		return nil
+	}
+	return client.handleIncoming(decoder, p)
+}
+
+// handleIncoming runs the incoming middleware on p, then its handlers.
+func (client *Client) handleIncoming(decoder *decoder, p *Packet) error {
+	if p.ctx == nil {
+		p.ctx = client.handlerContext()
+	}
+	client.middlewareLock.RLock()
+	chain := client.incoming
+	client.middlewareLock.RUnlock()
+
+	if len(chain) == 0 {
+		return client.dispatch(decoder, p)
+	}
+	return runMiddleware(chain, p, func(p *Packet) error {
+		if err := decoder.load(p); err != nil {
+			return err
 		}
-		client.onPacket(nil, &p)
-	}()
+		return client.dispatch(decoder, p)
+	})
+}
+
+func (client *Client) dispatch(decoder *decoder, p *Packet) error {
+	if client.opts.Sampler != nil && (p.Type == _EVENT || p.Type == _BINARY_EVENT) {
+		client.sampleIncoming(decoder)
+	}
+	ret, err := client.onPacket(decoder, p)
+	if p.Type == _CONNECT || p.Type == _ERROR {
+		client.ackConnect(p.Type)
+		client.manager.answered(p.NSP)
+	}
+	if err != nil {
+		// invoke something
+		return err
+	}
+	switch p.Type {
+	case _CONNECT:
+		// the manager routed p by its namespace, which is client.namespace
+		// !!!下面这个不能有，否则会有死循环
+		//client.sendConnect()
+	case _BINARY_EVENT:
+		fallthrough
+	case _EVENT:
+		if p.Id >= 0 {
+			if codec := client.codec(decoder.Message()); codec != nil {
+				if ret, err = encodeArgs(codec, ret); err != nil {
+					return err
+				}
+			}
+			p := Packet{
+				Type: _ACK,
+				Id:   p.Id,
+				NSP:  client.namespace,
+				Data: ret,
+			}
+			if err := client.sendPacket(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// write sends p on the current connection, or queues it while reconnecting
+// when Options.BufferEmits is set.
+func (client *Client) write(p *Packet) error {
+	client.bufferLock.Lock()
+	defer client.bufferLock.Unlock()
+
+	conn, reconnecting, flushing := client.manager.writeState()
+	switch {
+	case reconnecting && p.Type == _CONNECT:
+		// sent again once reconnected
+		return nil
+	case (reconnecting || flushing) && p.Type == _EVENT && client.outbox != nil:
+		p.seq = client.manager.nextSeq()
+		return client.outbox.Push(*p)
+	case flushing && p.Type == _EVENT:
+		// behind the events queued in the other namespaces
+		p.seq = client.manager.nextSeq()
+		return client.flushQueue.Push(*p)
+	}
+	if client.opts.Sampler != nil && p.Type == _EVENT {
+		client.sampleOutgoing(p)
+	}
+	return client.encode(conn, *p)
+}
+
+// encode writes p on conn and counts it in the client stats.
+func (client *Client) encode(conn *clientConn, p Packet) error {
+	var fw frameWriter = conn
+	if p.ctx != nil {
+		fw = &ctxWriter{conn: conn, ctx: p.ctx}
+	}
+	w := &countingWriter{frameWriter: fw}
+	e := newEncoder(w, client.opts.Tracer, client.opts.Parser)
+	e.max = client.opts.MaxPayload
+	if err := e.Encode(p); err != nil {
+		return err
+	}
+	var event string
+	if args, ok := p.Data.([]interface{}); ok && len(args) > 0 && p.Type == _EVENT {
+		event, _ = args[0].(string)
+	}
+	client.stats.count(statsSent, e.sent, event, w.n)
+	return nil
+}
+
+// flushOutbox sends the queued events in order, keeping whatever could not
+// be sent for the next connection.
+func (client *Client) flushOutbox() error {
+	client.bufferLock.Lock()
+	defer client.bufferLock.Unlock()
+
+	conn, _ := client.manager.connection()
 	for {
-		decoder := newDecoder(client.conn)
-		var p packet
-		if err := decoder.Decode(&p); err != nil {
+		p, ok, err := client.outbox.Peek()
+		if err != nil || !ok {
 			return err
 		}
-		ret, err := client.onPacket(decoder, &p)
-		if err != nil {
-			// invoke something
+		if err := client.encode(conn, p); err != nil {
 			return err
 		}
-		switch p.Type {
-		case _CONNECT:
-			client.namespace = p.NSP
-			// !!!下面这个不能有，否则会有死循环
-			//client.sendConnect()
-		case _BINARY_EVENT:
-			fallthrough
-		case _EVENT:
-			if p.Id >= 0 {
-				p := packet{
-					Type: _ACK,
-					Id:   p.Id,
-					NSP:  client.namespace,
-					Data: ret,
-				}
-				encoder := newEncoder(client.conn)
-				if err := encoder.Encode(p); err != nil {
-					return err
-				}
-			}
-		case _DISCONNECT:
-			return nil
+		if err := client.outbox.Pop(); err != nil {
+			return err
+		}
+	}
+}
+
+// queue returns where the events of client wait for the ordered flush of
+// the manager.
+func (client *Client) queue() Outbox {
+	if client.outbox != nil {
+		return client.outbox
+	}
+	return &client.flushQueue
+}
+
+// emitLocal invokes the handler of a client side event such as "reconnect"
+// with args.
+func (client *Client) emitLocal(message string, args ...interface{}) {
+	client.eventsLock.RLock()
+	c, ok := client.events[message]
+	client.eventsLock.RUnlock()
+	if !ok {
+		return
+	}
+	in := c.GetArgs(len(args))
+	for i := range in {
+		if i >= len(args) || args[i] == nil {
+			continue
+		}
+		v := reflect.ValueOf(args[i])
+		if dst := reflect.ValueOf(in[i]).Elem(); v.Type().AssignableTo(dst.Type()) {
+			dst.Set(v)
+		}
+	}
+	client.invoke(nil, message, c, in)
+}
+
+// onUnhandledEvent reports an event without a handler.
+func (client *Client) onUnhandledEvent(event string, decoder *decoder) error {
+	if f := client.opts.OnUnhandledEvent; f != nil {
+		f(event, decoder.payload())
+	}
+	if !client.opts.StrictEvents {
+		client.manager.log.Debugf("socket.io %s: no handler for %q", client.Namespace(), event)
+		return nil
+	}
+	client.manager.log.Errorf("socket.io %s: no handler for %q", client.Namespace(), event)
+	return fmt.Errorf("%w %q", ErrUnhandledEvent, event)
+}
+
+func (client *Client) onDisconnect() {
+	p := Packet{
+		Type: _DISCONNECT,
+		Id:   -1,
+	}
+	client.onPacket(nil, &p)
+	client.cancelContext()
+}
+
+// Wait blocks until the goroutines of the connection used by the client,
+// handlers included, have stopped. They stop once the last client using it
+// is closed and Options.Linger has passed, Options.Context is canceled or
+// reconnecting is given up. It must not be called from a handler.
+func (client *Client) Wait() {
+	client.manager.wait()
+}
+
+// Done returns a channel closed once the connection used by the client is
+// closed for good: after the last client using it is closed and
+// Options.Linger has passed, once Options.Context is canceled, once it is
+// lost without Options.Reconnection or once reconnecting is given up.
+func (client *Client) Done() <-chan struct{} {
+	return client.manager.done
+}
+
+// Err returns nil until Done is closed, and then why: ErrClosed when closed
+// on purpose, wrapping the error of Options.Context when canceled, the error
+// that lost the connection without Options.Reconnection, or
+// ErrReconnectFailed.
+func (client *Client) Err() error {
+	return client.manager.closeErr()
+}
+
+// Run drives the client until ctx is done, closing it then, or until its
+// connection is closed for good, so it can run in an errgroup.Group next to
+// other loops:
+//
+//	g.Go(func() error { return client.Run(ctx) })
+//
+// It returns ctx.Err() in the first case. Otherwise it returns Err once the
+// goroutines of the connection have stopped, or nil when the client was
+// closed on purpose, with Close or by canceling Options.Context.
+func (client *Client) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		client.Close()
+		return ctx.Err()
+	case <-client.Done():
+		client.Wait()
+		if err := client.Err(); !closedOnPurpose(err) {
+			return err
 		}
+		return nil
 	}
 }
 
+// Close leaves the namespace. The underlying connection is closed once no
+// other namespace uses it and Options.Linger has passed.
 func (client *Client) Close() error {
-	return client.conn.Close()
+	if client.namespace != "" && client.manager.client(client.namespace) == client {
+		p := Packet{
+			Type: _DISCONNECT,
+			Id:   -1,
+			NSP:  client.namespace,
+		}
+		client.sendPacket(p)
+	}
+	attached, err := client.manager.release(client)
+	if attached {
+		client.onDisconnect()
+	}
+	// no answer to wait for before flushing the other outboxes
+	client.manager.answered(client.namespace)
+	client.failAcks(ErrClosed)
+	return err
 }
@@ -1,7 +1,8 @@
 package socketio_client
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,31 +10,70 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/zhouhui8915/engine.io-go/message"
 	"github.com/zhouhui8915/engine.io-go/parser"
-	"github.com/zhouhui8915/engine.io-go/polling"
 	"github.com/zhouhui8915/engine.io-go/transport"
-	"github.com/zhouhui8915/engine.io-go/websocket"
 )
 
+// InvalidError is returned, wrapped with the transport names, when
+// Options.Transport names a transport that is not registered or a
+// combination that cannot be opened.
 var InvalidError = errors.New("invalid transport")
 
-var transports = []string{"polling", "websocket"}
+var errUpgradeClosed = errors.New("upgrade transport closed before the probe was answered")
 
-var creators map[string]transport.Creater
+// upgradeTimeout bounds the wait for the answer to the upgrade probe.
+func upgradeTimeout(opts *Options) time.Duration {
+	if opts.UpgradeTimeout > 0 {
+		return opts.UpgradeTimeout
+	}
+	return 10 * time.Second
+}
 
-func init() {
-	creators = make(map[string]transport.Creater)
-	for _, t := range transports {
-		switch t {
-		case "polling":
-			creators[t] = polling.Creater
-		case "websocket":
-			creators[t] = websocket.Creater
-		}
+var errUpgradeWait = errors.New("upgrade still in progress")
+
+func upgradeWait(opts *Options) time.Duration {
+	if opts.UpgradeWait > 0 {
+		return opts.UpgradeWait
+	}
+	return 1500 * time.Millisecond
+}
+
+var (
+	creatorsLocker sync.RWMutex
+	creators       = map[string]transport.Creater{
+		"polling":   pollingCreater,
+		"websocket": websocketCreater,
+		"memory":    memoryCreater,
+	}
+)
+
+// RegisterTransport makes creater available under name in
+// Options.Transport, replacing the built-in transport of that name if any.
+// A transport listed along with "polling" is upgraded to when its creater
+// is Upgrading; one listed alone is opened directly.
+func RegisterTransport(name string, creater transport.Creater) {
+	creatorsLocker.Lock()
+	defer creatorsLocker.Unlock()
+	creators[name] = creater
+}
+
+func lookupTransport(name string) (transport.Creater, bool) {
+	creatorsLocker.RLock()
+	defer creatorsLocker.RUnlock()
+	creater, ok := creators[name]
+	return creater, ok
+}
+
+// setWebsocketScheme switches an http(s) url to ws(s).
+func setWebsocketScheme(u *url.URL) {
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
 	}
 }
 
@@ -54,11 +94,27 @@ const (
 	stateClosed
 )
 
+func (s state) String() string {
+	switch s {
+	case stateNormal:
+		return "normal"
+	case stateUpgrading:
+		return "upgrading"
+	case stateClosing:
+		return "closing"
+	case stateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
 type clientConn struct {
 	id              string
 	options         *Options
+	log             Logger
 	url             *url.URL
 	request         *http.Request
+	jar             http.CookieJar
 	writerLocker    sync.Mutex
 	transportLocker sync.RWMutex
 	currentName     string
@@ -67,45 +123,151 @@ type clientConn struct {
 	upgrading       transport.Client
 	state           state
 	stateLocker     sync.RWMutex
-	readerChan      chan *connReader
+	stateChanged    chan struct{} //closed and replaced on each state change
+	readerChan      chan *incomingFrame
+	pending         []*incomingFrame //attachments of the packet last handed out by NextReader
+	assembling      *incomingFrame   //binary packet waiting for its attachments, see assemble
+	done            chan struct{}    //closed once the connection is shut down
+	err             error            //why the connection was shut down, set before done is closed
+	closeOnce       sync.Once
+	ctx             context.Context //closes the connection once canceled
+	wg              sync.WaitGroup  //pingLoop and readLoop
 	pingTimeout     time.Duration
 	pingInterval    time.Duration
 	pingChan        chan bool
+	handshake       *Handshake
+	response        *HandshakeResponse
+	limiter         *Limiter
+	releaseOnce     sync.Once
+	latency         latencyWindow
+	resume          *clientConn //lost connection whose session is taken over, see Options.ResumeSession
+	resumed         bool        //the session of resume was taken over
+	early           [][]byte    //packets resumeSession read before the pong, for readLoop
+	lost            int64       //unix nanoseconds the transport failed at, -1 once the server closed the session
 }
 
-func newClientConn(opts *Options, u *url.URL) (client *clientConn, err error) {
+// newClientConn opens a connection to u, giving up at deadline, or after
+// Options.ConnectTimeout when deadline is zero. The connection is closed
+// once ctx is canceled.
+func newClientConn(ctx context.Context, opts *Options, u *url.URL, jar http.CookieJar, deadline time.Time) (*clientConn, error) {
+	return dialClientConn(ctx, opts, u, jar, nil, deadline)
+}
+
+// resumeClientConn is newClientConn taking over the engine.io session of
+// the lost connection prev, see Options.ResumeSession.
+func resumeClientConn(ctx context.Context, opts *Options, prev *clientConn) (*clientConn, error) {
+	return dialClientConn(ctx, opts, prev.url, prev.jar, prev, time.Time{})
+}
+
+func dialClientConn(ctx context.Context, opts *Options, u *url.URL, jar http.CookieJar, resume *clientConn, deadline time.Time) (client *clientConn, err error) {
 	if opts.Transport == nil {
 		opts.Transport = []string{"websocket", "polling"}
 	}
 
 	for _, transport := range opts.Transport {
-		_, exists := creators[transport]
+		_, exists := lookupTransport(transport)
 		if !exists {
-			return nil, InvalidError
+			return nil, fmt.Errorf("%w %q", InvalidError, transport)
 		}
 	}
 
+	if opts.QueryFunc != nil && resume == nil {
+		dynamic := *u
+		dynamic.RawQuery = mergeQuery(u.RawQuery, opts.QueryFunc())
+		u = &dynamic
+	}
+
 	client = &clientConn{
 		url:          u,
 		options:      opts,
+		log:          optionsLogger(opts),
+		jar:          jar,
 		state:        stateNormal,
+		stateChanged: make(chan struct{}),
 		pingTimeout:  60000 * time.Millisecond,
 		pingInterval: 25000 * time.Millisecond,
 		pingChan:     make(chan bool),
-		readerChan:   make(chan *connReader),
+		readerChan:   make(chan *incomingFrame, incomingBuffer(opts)),
+		done:         make(chan struct{}),
+		ctx:          ctx,
+		limiter:      optionsLimiter(opts),
+		resume:       resume,
+	}
+
+	if opts.InsecureSkipVerify {
+		warnInsecure(client.log, u)
 	}
 
-	err = client.onOpen()
+	// canceling dialCtx aborts the dial and the handshake requests; it is
+	// left alone once the connection is open, so that the requests of the
+	// transports, such as the one sending CLOSE, are not cut off by ctx
+	dialCtx, cancel := context.WithCancel(context.Background())
+	opened := make(chan struct{})
+	go labeled(opts, func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-opened:
+		}
+	}, "dial")()
+	if deadline.IsZero() && opts.ConnectTimeout > 0 {
+		deadline = time.Now().Add(opts.ConnectTimeout)
+	}
+	var timer *time.Timer
+	if !deadline.IsZero() {
+		timer = time.AfterFunc(time.Until(deadline), labeled(opts, cancel, "connectTimeout"))
+	}
+
+	// dialCtx is canceled at the deadline too, so waiting for the limiter
+	// counts in the connect timeout
+	if err = client.limiter.acquireConn(dialCtx); err != nil {
+		// no slot to give back
+		client.releaseOnce.Do(func() {})
+	} else if err = client.limiter.acquireHandshake(dialCtx); err == nil {
+		err = client.onOpen(dialCtx)
+		client.limiter.releaseHandshake()
+	}
+	close(opened)
+	if err == nil && ctx.Err() != nil {
+		client.Close()
+		err = ctx.Err()
+	}
 	if err != nil {
+		client.closeTransports()
+	}
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			client.Close()
+		}
+		err = connectTimeout(opts)
+		client.release()
+		return
+	}
+	if err != nil {
+		client.release()
+		var status *statusError
+		if errors.As(err, &status) {
+			err = &HandshakeError{Response: status.response, Err: err}
+		}
+		err = classifyConnectError(err)
+		if isResourceExhausted(err) {
+			err = &ResourceExhaustedError{Err: err}
+		}
 		return
 	}
 
+	client.wg.Add(2)
 	go client.pingLoop()
 	go client.readLoop()
 
 	return
 }
 
+// wait blocks until the goroutines of the connection have stopped.
+func (c *clientConn) wait() {
+	c.wg.Wait()
+}
+
 func (c *clientConn) Id() string {
 	return c.id
 }
@@ -115,33 +277,48 @@ func (c *clientConn) Request() *http.Request {
 }
 
 func (c *clientConn) NextReader() (MessageType, io.ReadCloser, error) {
-	if c.getState() == stateClosed {
-		return MessageBinary, nil, io.EOF
+	if len(c.pending) > 0 {
+		ret := c.pending[0]
+		c.pending = c.pending[1:]
+		return ret.typ, ret.r, nil
 	}
-	ret := <-c.readerChan
-	if ret == nil {
-		return MessageBinary, nil, io.EOF
+	// messages already queued are handed out before the end of the connection
+	select {
+	case ret := <-c.readerChan:
+		c.pending = ret.attachments
+		return ret.typ, ret.r, nil
+	default:
+	}
+	select {
+	case ret := <-c.readerChan:
+		c.pending = ret.attachments
+		return ret.typ, ret.r, nil
+	case <-c.done:
+		return MessageBinary, nil, c.closeErr()
 	}
-	return MessageType(ret.MessageType()), ret, nil
 }
 
 func (c *clientConn) NextWriter(t MessageType) (io.WriteCloser, error) {
-	switch c.getState() {
+	return c.nextWriter(context.Background(), t)
+}
+
+// nextWriter is NextWriter giving up once ctx is done.
+func (c *clientConn) nextWriter(ctx context.Context, t MessageType) (io.WriteCloser, error) {
+	switch c.waitUpgrade(ctx) {
 	case stateUpgrading:
-		for i := 0; i < 30; i++ {
-			time.Sleep(50 * time.Millisecond)
-			if c.getState() != stateUpgrading {
-				break
-			}
-		}
-		if c.getState() == stateUpgrading {
-			return nil, fmt.Errorf("upgrading")
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
+		return nil, errUpgradeWait
 	case stateNormal:
 	default:
-		return nil, io.EOF
+		return nil, c.closeErr()
 	}
 	c.writerLocker.Lock()
+	if err := ctx.Err(); err != nil {
+		c.writerLocker.Unlock()
+		return nil, err
+	}
 	ret, err := c.getCurrent().NextWriter(message.MessageType(t), parser.MESSAGE)
 	if err != nil {
 		c.writerLocker.Unlock()
@@ -151,25 +328,48 @@ func (c *clientConn) NextWriter(t MessageType) (io.WriteCloser, error) {
 	return writer, err
 }
 
-func (c *clientConn) Close() error {
-	if c.getState() != stateNormal && c.getState() != stateUpgrading {
-		return nil
-	}
-	if c.upgrading != nil {
-		c.upgrading.Close()
-	}
-	c.writerLocker.Lock()
-	if w, err := c.getCurrent().NextWriter(message.MessageText, parser.CLOSE); err == nil {
-		writer := newConnWriter(w, &c.writerLocker)
-		writer.Close()
-	} else {
-		c.writerLocker.Unlock()
-	}
-	if err := c.getCurrent().Close(); err != nil {
-		return err
+// closeErr returns ErrClosed, wrapping why the connection closed once it
+// is.
+func (c *clientConn) closeErr() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return ErrClosed
 	}
-	c.setState(stateClosing)
-	return nil
+}
+
+// Close sends the engine.io CLOSE packet and shuts the connection down. It
+// can be called any number of times from any goroutine.
+func (c *clientConn) Close() error {
+	return c.shutdown(true, nil)
+}
+
+// shutdown closes the transports and ends the connection once, telling the
+// server first when sendClose is set. cause tells why, nil when closed on
+// purpose.
+func (c *clientConn) shutdown(sendClose bool, cause error) (err error) {
+	c.closeOnce.Do(func() {
+		c.err = ErrClosed
+		if cause != nil {
+			c.err = &classError{class: ErrClosed, err: fmt.Errorf("engine.io %s: %w", c.id, cause)}
+		}
+		if s := c.getState(); sendClose && (s == stateNormal || s == stateUpgrading) {
+			c.writerLocker.Lock()
+			if w, err := c.getCurrent().NextWriter(message.MessageText, parser.CLOSE); err == nil {
+				w.Close()
+			}
+			c.writerLocker.Unlock()
+		}
+		c.setState(stateClosed)
+		if t := c.getUpgrade(); t != nil {
+			t.Close()
+		}
+		err = c.getCurrent().Close()
+		c.release()
+		close(c.done)
+	})
+	return err
 }
 
 func (c *clientConn) OnPacket(r *parser.PacketDecoder) {
@@ -179,8 +379,10 @@ func (c *clientConn) OnPacket(r *parser.PacketDecoder) {
 	switch r.Type() {
 	case parser.OPEN:
 	case parser.CLOSE:
+		atomic.StoreInt64(&c.lost, -1)
 		c.getCurrent().Close()
 	case parser.PING:
+		c.log.Debugf("engine.io %s: ping received", c.id)
 		t := c.getCurrent()
 		u := c.getUpgrade()
 		newWriter := t.NextWriter
@@ -198,27 +400,35 @@ func (c *clientConn) OnPacket(r *parser.PacketDecoder) {
 		c.writerLocker.Unlock()
 		fallthrough
 	case parser.PONG:
-		c.pingChan <- true
+		c.log.Debugf("engine.io %s: pong received", c.id)
+		select {
+		case c.pingChan <- true:
+		case <-c.done:
+		}
 		if c.getState() == stateUpgrading {
 			p := make([]byte, 64)
 			_, err := r.Read(p)
 			if err == nil && strings.Contains(string(p), "probe") {
+				// hold the writer until the transports are swapped, so no
+				// message goes out on polling after the upgrade packet
+				c.log.Debugf("engine.io %s: probe answered on %s", c.id, c.upgradingName)
 				c.writerLocker.Lock()
+				if f, ok := c.getCurrent().(flusher); ok {
+					f.Flush()
+				}
 				w, _ := c.getUpgrade().NextWriter(message.MessageText, parser.UPGRADE)
 				if w != nil {
 					io.Copy(w, r)
 					w.Close()
 				}
-				c.writerLocker.Unlock()
-
 				c.upgraded()
+				c.writerLocker.Unlock()
 			}
 		}
 	case parser.MESSAGE:
-		closeChan := make(chan struct{})
-		c.readerChan <- newConnReader(r, closeChan)
-		<-closeChan
-		close(closeChan)
+		// copied so the transport goes on reading, answering pings while
+		// the packets are decoded and handled
+		c.queueMessage(MessageType(r.MessageType()), r)
 		r.Close()
 	case parser.UPGRADE:
 		c.upgraded()
@@ -226,196 +436,222 @@ func (c *clientConn) OnPacket(r *parser.PacketDecoder) {
 	}
 }
 
-func (c *clientConn) OnClose(server transport.Client) {
+// OnClose ends the connection, or the upgrade, once the reads of server
+// failed with err.
+func (c *clientConn) OnClose(server transport.Client, err error) {
+	c.transportLocker.RLock()
+	upgradeName, currentName := c.upgradingName, c.currentName
+	c.transportLocker.RUnlock()
 	if t := c.getUpgrade(); server == t {
+		c.log.Debugf("engine.io %s: upgrade transport closed", c.id)
 		c.setUpgrading("", nil)
 		t.Close()
+		c.onUpgradeError(upgradeName, errUpgradeClosed)
 		return
 	}
 	t := c.getCurrent()
 	if server != t {
 		return
 	}
-	t.Close()
+	c.log.Debugf("engine.io %s: %s transport closed", c.id, currentName)
+	c.markLost()
+	c.shutdown(false, fmt.Errorf("%s transport: %w", currentName, err))
+}
+
+// release gives the connection slot back to the limiter.
+// closeTransports closes the transports a failed dial opened.
+func (c *clientConn) closeTransports() {
 	if t := c.getUpgrade(); t != nil {
 		t.Close()
-		c.setUpgrading("", nil)
 	}
-	c.setState(stateClosed)
-	close(c.readerChan)
-	close(c.pingChan)
+	if t := c.getCurrent(); t != nil {
+		t.Close()
+	}
 }
 
-func (c *clientConn) onOpen() error {
+func (c *clientConn) release() {
+	c.releaseOnce.Do(c.limiter.releaseConn)
+}
 
-	var err error
-	if (len(c.options.Transport) == 2 &&
-		((c.options.Transport[0] == "polling" && c.options.Transport[1] == "websocket") ||
-			(c.options.Transport[1] == "polling" && c.options.Transport[0] == "websocket"))) ||
+func (c *clientConn) onOpen(ctx context.Context) error {
+
+	// polling first, then upgrade to the other transport if any
+	polling, upgrade := false, ""
+	for _, name := range c.options.Transport {
+		if name == "polling" {
+			polling = true
+		} else {
+			upgrade = name
+		}
+	}
 
-		(len(c.options.Transport) == 1 && c.options.Transport[0] == "polling") {
+	var err error
+	if polling && len(c.options.Transport) <= 2 {
 
-		c.request, err = http.NewRequest("GET", c.url.String(), nil)
+		c.request, err = http.NewRequestWithContext(ctx, "GET", c.url.String(), nil)
 		if err != nil {
 			return err
 		}
+		// the credentials go in the Authorization header
+		c.request.URL.User = nil
+		c.request = withOptions(c.request, c.options, c.jar)
 
-		creater, exists := creators["polling"]
+		creater, exists := lookupTransport("polling")
 		if !exists {
-			return InvalidError
+			return fmt.Errorf("%w %q", InvalidError, "polling")
 		}
 
-		q := c.request.URL.Query()
-		q.Set("transport", "polling")
-		c.request.URL.RawQuery = q.Encode()
-		if c.options.Header != nil {
-			c.request.Header = c.options.Header
+		c.request.URL.RawQuery = setQuery(c.request.URL.RawQuery, "transport", "polling")
+		c.request.Header = c.header("polling")
+		if c.resume != nil && c.resume.response != nil {
+			// back to the node holding the session
+			for k, v := range affinityHeader(c.options.AffinityHeaders, c.resume.response.Header) {
+				c.request.Header[k] = v
+			}
 		}
 
 		transport, err := creater.Client(c.request)
 		if err != nil {
-			return err
+			return fmt.Errorf("open polling: %w", err)
 		}
+		transport = c.recorded("polling", transport)
 		c.setCurrent("polling", transport)
 
-		pack, err := c.getCurrent().NextReader()
-		if err != nil {
-			return err
-		}
+		if c.resume != nil {
+			if err := c.resumeSession(); err != nil {
+				return fmt.Errorf("resume session %s: %w", c.resume.id, err)
+			}
+		} else {
+			pack, err := c.getCurrent().NextReader()
+			if err != nil {
+				return fmt.Errorf("polling handshake: %w", err)
+			}
 
-		p := make([]byte, 4096)
-		l, err := pack.Read(p)
-		if err != nil {
-			return err
-		}
+			p, err := readAll(pack)
+			if err != nil {
+				return fmt.Errorf("polling handshake: %w", err)
+			}
 
-		type connectionInfo struct {
-			Sid          string        `json:"sid"`
-			Upgrades     []string      `json:"upgrades"`
-			PingInterval time.Duration `json:"pingInterval"`
-			PingTimeout  time.Duration `json:"pingTimeout"`
+			if err = c.onHandshake(c.getCurrent(), p); err != nil {
+				return err
+			}
 		}
-
-		var msg connectionInfo
-		err = json.Unmarshal(p[:l], &msg)
-		if err != nil {
-			return err
+		if t, ok := c.getCurrent().(sessionSetter); ok {
+			t.setSession(c.id)
+		}
+		if moved := movedURL(c.getCurrent().Response()); moved != nil {
+			// upgrade where the server moved
+			moveTo(c.request.URL, moved)
 		}
-		msg.PingInterval *= 1000 * 1000
-		msg.PingTimeout *= 1000 * 1000
-
-		c.pingInterval = msg.PingInterval
-		c.pingTimeout = msg.PingTimeout
-		c.id = msg.Sid
 
-		if len(c.options.Transport) == 1 && c.options.Transport[0] == "polling" {
+		if upgrade == "" || c.options.DisableUpgrade || !c.handshake.canUpgrade(upgrade) {
 			//over
-		} else if len(c.options.Transport) == 2 &&
-			(c.options.Transport[0] == "websocket" ||
-				c.options.Transport[1] == "websocket") {
+		} else {
 			//upgrade
-			creater, exists = creators["websocket"]
+			creater, exists = lookupTransport(upgrade)
 			if !exists {
-				return InvalidError
+				return fmt.Errorf("%w %q", InvalidError, upgrade)
+			}
+			if !creater.Upgrading {
+				// nothing to upgrade to, stay on polling
+				return nil
 			}
 
-			if c.request.URL.Scheme == "https" {
-				c.request.URL.Scheme = "wss"
-			} else {
-				c.request.URL.Scheme = "ws"
+			setWebsocketScheme(c.request.URL)
+			c.request.URL.RawQuery = mergeQuery(c.request.URL.RawQuery, url.Values{
+				"sid":       {c.id},
+				"transport": {upgrade},
+			})
+			c.request.Header = c.header(upgrade)
+			if c.response != nil {
+				for k, v := range affinityHeader(c.options.AffinityHeaders, c.response.Header) {
+					c.request.Header[k] = v
+				}
 			}
-			q.Set("sid", c.id)
-			q.Set("transport", "websocket")
-			c.request.URL.RawQuery = q.Encode()
 
 			transport, err = creater.Client(c.request)
 			if err != nil {
-				return err
+				// stay on polling
+				c.onUpgradeError(upgrade, err)
+				return nil
 			}
-			c.setUpgrading("websocket", transport)
+			transport = c.recorded(upgrade, transport)
+			c.setUpgrading(upgrade, transport)
 
 			w, err := c.getUpgrade().NextWriter(message.MessageText, parser.PING)
 			if err != nil {
-				return err
+				c.setUpgrading("", nil)
+				transport.Close()
+				c.onUpgradeError(upgrade, fmt.Errorf("probe: %w", err))
+				return nil
 			}
 			w.Write([]byte("probe"))
 			w.Close()
-		} else {
-			return InvalidError
+			c.log.Debugf("engine.io %s: probe sent on %s", c.id, upgrade)
+			time.AfterFunc(upgradeTimeout(c.options), labeled(c.options, func() {
+				// readLoop falls back to polling once the probe transport is closed
+				if c.getUpgrade() == transport {
+					transport.Close()
+				}
+			}, "upgradeTimeout", "socketio.sid", c.id))
 		}
 		return nil
-	} else if len(c.options.Transport) == 1 && c.options.Transport[0] == "websocket" {
-		c.request, err = http.NewRequest("GET", c.url.String(), nil)
+	} else if len(c.options.Transport) == 1 {
+		name := c.options.Transport[0]
+		c.request, err = http.NewRequestWithContext(ctx, "GET", c.url.String(), nil)
 		if err != nil {
 			return err
 		}
+		// the credentials go in the Authorization header
+		c.request.URL.User = nil
+		c.request = withOptions(c.request, c.options, c.jar)
 
-		if c.request.URL.Scheme == "https" {
-			c.request.URL.Scheme = "wss"
-		} else {
-			c.request.URL.Scheme = "ws"
-		}
-
-		creater, exists := creators["websocket"]
+		creater, exists := lookupTransport(name)
 		if !exists {
-			return InvalidError
+			return fmt.Errorf("%w %q", InvalidError, name)
 		}
-
-		q := c.request.URL.Query()
-		q.Set("transport", "websocket")
-		c.request.URL.RawQuery = q.Encode()
-		if c.options.Header != nil {
-			c.request.Header = c.options.Header
+		if creater.Upgrading {
+			setWebsocketScheme(c.request.URL)
 		}
 
+		c.request.URL.RawQuery = setQuery(c.request.URL.RawQuery, "transport", name)
+		c.request.Header = c.header(name)
+
 		transport, err := creater.Client(c.request)
 		if err != nil {
-			return err
+			return fmt.Errorf("open %s: %w", name, err)
 		}
-		c.setUpgrading("websocket", transport)
+		transport = c.recorded(name, transport)
+		c.setUpgrading(name, transport)
 
 		pack, err := c.getUpgrade().NextReader()
 		if err != nil {
-			return err
+			return fmt.Errorf("%s handshake: %w", name, err)
 		}
 
-		p := make([]byte, 4096)
-		l, err := pack.Read(p)
+		p, err := readAll(pack)
 		if err != nil {
-			return err
-		}
-
-		type connectionInfo struct {
-			Sid          string        `json:"sid"`
-			Upgrades     []string      `json:"upgrades"`
-			PingInterval time.Duration `json:"pingInterval"`
-			PingTimeout  time.Duration `json:"pingTimeout"`
+			return fmt.Errorf("%s handshake: %w", name, err)
 		}
 
-		var msg connectionInfo
-		err = json.Unmarshal(p[:l], &msg)
-		if err != nil {
+		if err = c.onHandshake(c.getUpgrade(), p); err != nil {
 			return err
 		}
-		msg.PingInterval *= 1000 * 1000
-		msg.PingTimeout *= 1000 * 1000
-
-		c.pingInterval = msg.PingInterval
-		c.pingTimeout = msg.PingTimeout
-		c.id = msg.Sid
 
 		//upgrade
 
-		q.Set("sid", c.id)
-		q.Set("transport", "websocket")
-		c.request.URL.RawQuery = q.Encode()
+		c.request.URL.RawQuery = mergeQuery(c.request.URL.RawQuery, url.Values{
+			"sid":       {c.id},
+			"transport": {name},
+		})
 
 		//transport, err = creater.Client(c.request)
 		if err != nil {
 			return err
 		}
-		c.setCurrent("websocket", transport)
-		c.setState(stateNormal)
+		c.setCurrent(name, transport)
+		// opened directly, there is no upgrade to wait for
+		c.setUpgrading("", nil)
 
 		// w, err := c.getCurrent().NextWriter(message.MessageText, parser.PING)
 		// if err != nil {
@@ -426,7 +662,120 @@ func (c *clientConn) onOpen() error {
 
 		return nil
 	}
-	return InvalidError
+	return fmt.Errorf("%w combination %q", InvalidError, c.options.Transport)
+}
+
+// resumeSession takes over the session of c.resume on the polling
+// transport, making sure with a ping that the server still holds it: the
+// session is resumed once the pong arrives, within the ping timeout.
+func (c *clientConn) resumeSession() error {
+	prev := c.resume
+	c.id = prev.id
+	c.handshake = prev.handshake
+	c.response = prev.response
+	c.pingInterval = prev.pingInterval
+	c.pingTimeout = prev.pingTimeout
+	t := c.getCurrent()
+	if s, ok := t.(sessionSetter); ok {
+		s.setSession(c.id)
+	}
+	w, err := t.NextWriter(message.MessageText, parser.PING)
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if f, ok := t.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	// closing the transport ends the poll waiting for the pong
+	timer := time.AfterFunc(c.pingTimeout, labeled(c.options, func() { t.Close() }, "resume", "socketio.sid", c.id))
+	defer timer.Stop()
+	for {
+		pack, err := t.NextReader()
+		if err != nil {
+			if !timer.Stop() {
+				return fmt.Errorf("no pong within %v", c.pingTimeout)
+			}
+			return err
+		}
+		data, err := readAll(pack)
+		pack.Close()
+		if err != nil {
+			return err
+		}
+		if pack.Type() == parser.PONG {
+			break
+		}
+		if pack.Type() == parser.CLOSE {
+			return errors.New("session closed by the server")
+		}
+		// what the server held for the session comes first
+		c.early = append(c.early, newRecord(false, "", pack.MessageType(), pack.Type(), data).frame().Data)
+	}
+	if !timer.Stop() {
+		// closed as the pong arrived
+		return fmt.Errorf("no pong within %v", c.pingTimeout)
+	}
+	c.resume, c.resumed = nil, true
+	c.log.Debugf("engine.io %s: session resumed", c.id)
+	return nil
+}
+
+// markLost records the failure of the polling transport of c, reporting
+// whether its session may be resumed.
+func (c *clientConn) markLost() bool {
+	c.transportLocker.RLock()
+	name := c.currentName
+	c.transportLocker.RUnlock()
+	if name != "polling" || c.getState() != stateNormal {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&c.lost, 0, time.Now().UnixNano())
+}
+
+// resumable reports whether the session of c, lost to a failure of its
+// polling transport, may still be held by the server at now.
+func (c *clientConn) resumable(now time.Time) bool {
+	lost := atomic.LoadInt64(&c.lost)
+	if lost <= 0 || c.id == "" {
+		return false
+	}
+	return now.Sub(time.Unix(0, lost)) < c.pingInterval+c.pingTimeout
+}
+
+func (c *clientConn) onHandshake(t transport.Client, b []byte) error {
+	cache, origin := c.options.HandshakeCache, handshakeOrigin(c.url)
+	var (
+		sid string
+		hs  *Handshake
+	)
+	if cache != nil {
+		sid, hs = cache.lookup(origin, b)
+	}
+	if hs == nil {
+		var err error
+		if sid, hs, err = parseHandshake(b); err != nil {
+			return &HandshakeError{
+				Response: newHandshakeResponse(t.Response(), b),
+				Err:      err,
+			}
+		}
+		if cache != nil {
+			hs = cache.store(origin, b, hs)
+		}
+	}
+	c.response = newHandshakeResponse(t.Response(), nil)
+	c.handshake = hs
+	c.pingInterval = hs.PingInterval
+	c.pingTimeout = hs.PingTimeout
+	c.id = sid
+	c.log.Debugf("engine.io %s: open, upgrades %v, ping interval %v, ping timeout %v",
+		sid, hs.Upgrades, hs.PingInterval, hs.PingTimeout)
+	return nil
 }
 
 func (c *clientConn) getCurrent() transport.Client {
@@ -457,7 +806,11 @@ func (c *clientConn) setUpgrading(name string, s transport.Client) {
 
 	c.upgradingName = name
 	c.upgrading = s
-	c.setState(stateUpgrading)
+	if s != nil {
+		c.setState(stateUpgrading)
+	} else if c.getState() == stateUpgrading {
+		c.setState(stateNormal)
+	}
 }
 
 func (c *clientConn) upgraded() {
@@ -472,7 +825,26 @@ func (c *clientConn) upgraded() {
 	c.transportLocker.Unlock()
 
 	current.Close()
+	c.log.Debugf("engine.io %s: upgraded to %s", c.id, c.currentName)
 	c.setState(stateNormal)
+	if c.options.OnUpgrade != nil {
+		c.options.OnUpgrade(c.currentName)
+	}
+}
+
+func (c *clientConn) onUpgradeError(name string, err error) {
+	err = &classError{class: ErrUpgradeFailed, err: fmt.Errorf("upgrade to %s: %w", name, err)}
+	c.log.Infof("engine.io %s: upgrade failed: %v", c.id, err)
+	if c.options.OnUpgradeError != nil {
+		c.options.OnUpgradeError(err)
+	}
+}
+
+// transportName returns the name of the transport carrying the messages.
+func (c *clientConn) transportName() string {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+	return c.currentName
 }
 
 func (c *clientConn) getState() state {
@@ -484,35 +856,74 @@ func (c *clientConn) getState() state {
 func (c *clientConn) setState(state state) {
 	c.stateLocker.Lock()
 	defer c.stateLocker.Unlock()
+	if c.state != state {
+		c.log.Debugf("engine.io %s: state %s -> %s", c.id, c.state, state)
+		close(c.stateChanged)
+		c.stateChanged = make(chan struct{})
+	}
 	c.state = state
 }
 
+// waitUpgrade returns the state once no upgrade is in progress, or
+// stateUpgrading when Options.UpgradeWait passed or ctx was done first.
+func (c *clientConn) waitUpgrade(ctx context.Context) state {
+	var timeout <-chan time.Time
+	for {
+		c.stateLocker.RLock()
+		state, changed := c.state, c.stateChanged
+		c.stateLocker.RUnlock()
+		if state != stateUpgrading {
+			return state
+		}
+		if timeout == nil {
+			timer := time.NewTimer(upgradeWait(c.options))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return stateUpgrading
+		case <-ctx.Done():
+			return stateUpgrading
+		}
+	}
+}
+
 func (c *clientConn) pingLoop() {
-	defer c.Close()
+	setGoroutineLabels(c.options, "pingLoop", "socketio.sid", c.id)
+	defer c.wg.Done()
 	// set interval for ping
 	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
 	for {
-		var ierr error
-		go func() {
-			// send ping
-			c.writerLocker.Lock()
-			defer c.writerLocker.Unlock()
-			w, err := c.getCurrent().NextWriter(message.MessageText, parser.PING)
-			if err != nil {
-				ierr = err
-				return
-			}
-			defer w.Close()
-		}()
-		if ierr != nil {
-			log.Errorf("pingLoop failed, %v", ierr)
+		sent := time.Now()
+		c.writerLocker.Lock()
+		w, err := c.getCurrent().NextWriter(message.MessageText, parser.PING)
+		if err == nil {
+			err = w.Close()
+		}
+		c.writerLocker.Unlock()
+		if err != nil {
+			c.log.Errorf("pingLoop failed, %v", err)
+			// CLOSE would end a session that may still be resumed
+			lost := c.options.ResumeSession && c.markLost()
+			c.shutdown(!lost, fmt.Errorf("ping: %w", err))
 			return
 		}
+		c.log.Debugf("engine.io %s: ping sent", c.id)
 		// receive pong msg, or trigger timeout for pong msg
 		select {
 		case <-c.pingChan:
-
+			c.latency.add(time.Since(sent))
 		case <-time.After(c.pingTimeout):
+			c.log.Infof("engine.io %s: no pong within %v, closing", c.id, c.pingTimeout)
+			c.shutdown(true, fmt.Errorf("%w: no pong within %v", ErrPingTimeout, c.pingTimeout))
+			return
+		case <-c.done:
+			return
+		case <-c.ctx.Done():
+			c.shutdown(true, c.ctx.Err())
 			return
 		}
 
@@ -524,21 +935,39 @@ func (c *clientConn) pingLoop() {
 				break for_Ticker
 			case <-c.pingChan:
 				continue
+			case <-c.done:
+				return
+			case <-c.ctx.Done():
+				c.shutdown(true, c.ctx.Err())
+				return
 			}
 		}
 	}
 }
 
 func (c *clientConn) readLoop() {
-	current := c.getCurrent()
-	defer c.OnClose(current)
+	setGoroutineLabels(c.options, "readLoop", "socketio.sid", c.id)
+	defer c.wg.Done()
+	for _, frame := range c.early {
+		if pack, err := parser.NewDecoder(bytes.NewReader(frame)); err == nil {
+			c.OnPacket(pack)
+			pack.Close()
+		}
+	}
+	c.early = nil
 	for {
-		current = c.getCurrent()
-		if c.getUpgrade() != nil {
-			current = c.getUpgrade()
+		current := c.getCurrent()
+		upgrade := c.getUpgrade()
+		if upgrade != nil {
+			current = upgrade
 		}
 		pack, err := current.NextReader()
 		if err != nil {
+			c.OnClose(current, err)
+			if current == upgrade {
+				// the probe failed, carry on with the current transport
+				continue
+			}
 			return
 		}
 		c.OnPacket(pack)
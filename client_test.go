@@ -0,0 +1,235 @@
+package socketio_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/h2570su/go-socket.io-client/sockettest"
+)
+
+func TestNewClientNilOptions(t *testing.T) {
+	srv := sockettest.NewServer()
+	defer srv.Close()
+	srv.Ack("join", "ok")
+
+	client, err := NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	acks := make(chan string, 1)
+	if err := client.Emit("join", "lobby", func(s string) { acks <- s }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-acks:
+		if s != "ok" {
+			t.Fatalf("ack %q, want ok", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ack")
+	}
+	if events := srv.Events(); len(events) != 1 || events[0].Name != "join" {
+		t.Fatalf("events %+v", events)
+	}
+}
+
+func TestNewClientNamespaceRefused(t *testing.T) {
+	srv := sockettest.NewServer()
+	defer srv.Close()
+	srv.Reject("/admin", "not allowed")
+
+	_, err := NewClient(srv.URL, &Options{Namespace: "/admin"})
+	if !errors.Is(err, ErrNamespaceRefused) {
+		t.Fatalf("NewClient() error = %v, want ErrNamespaceRefused", err)
+	}
+}
+
+func TestConnectTimeoutWaitsForConnectAck(t *testing.T) {
+	// namespace connects are never answered
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		return true
+	})
+	opts := memoryOptions()
+	opts.Namespace = "/chat"
+	opts.ConnectTimeout = 100 * time.Millisecond
+	_, err := NewClient(uri, opts)
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("NewClient() error = %v, want ErrConnectTimeout", err)
+	}
+}
+
+func TestConnectTimeoutCoversFallbacks(t *testing.T) {
+	// listeners never accepting connections
+	var uris []string
+	for i := 0; i < 3; i++ {
+		l, err := ListenMemory(fmt.Sprintf("%s-%d", t.Name(), i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		uris = append(uris, "memory://"+l.name)
+	}
+	opts := memoryOptions()
+	opts.FallbackURLs = uris[1:]
+	opts.ConnectTimeout = 200 * time.Millisecond
+	start := time.Now()
+	_, err := NewClient(uris[0], opts)
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("NewClient() error = %v, want ErrConnectTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 450*time.Millisecond {
+		t.Fatalf("NewClient() gave up after %v, want about %v", elapsed, opts.ConnectTimeout)
+	}
+}
+
+func TestConnectTimeoutCoversLimiter(t *testing.T) {
+	uri := newMemoryServer(t, nil)
+	limiter := NewLimiter(0, 1)
+	limiter.conns <- struct{}{} // the only slot is taken
+	opts := memoryOptions()
+	opts.Limiter = limiter
+	opts.ConnectTimeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err := NewClient(uri, opts)
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("NewClient() error = %v, want ErrConnectTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("NewClient() gave up after %v, want about %v", elapsed, opts.ConnectTimeout)
+	}
+	if n := len(limiter.conns); n != 1 {
+		t.Fatalf("%d slots taken, want the first one only", n)
+	}
+}
+
+func TestDecryptSkipsConnectAndError(t *testing.T) {
+	events := make(chan string, 2)
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		if !bytes.HasPrefix(f.Data, []byte("42")) {
+			return false
+		}
+		if string(f.Data) == `42["first"]` {
+			// neither is sealed
+			conn.WriteFrame(MemoryFrame{Data: []byte(`40`)})
+			conn.WriteFrame(MemoryFrame{Data: []byte(`44"oops"`)})
+		}
+		events <- string(f.Data)
+		return true
+	})
+	opts := memoryOptions()
+	opts.Dispatch = DispatchSerial
+	opts.Decrypt = func(event string, sealed []byte) ([]byte, error) {
+		if len(sealed) == 0 {
+			return nil, errors.New("nothing sealed")
+		}
+		return sealed, nil
+	}
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	handled := make(chan string, 2)
+	client.On("connection", func() { handled <- "connection" })
+	client.On("error", func() { handled <- "error" })
+	for _, event := range []string{"first", "second"} {
+		if err := client.Emit(event); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not received, the connection dropped", event)
+		}
+	}
+	for _, want := range []string{"connection", "error"} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Errorf("handled %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not handled", want)
+		}
+	}
+}
+
+func TestEmitContext(t *testing.T) {
+	uri := newMemoryServer(t, nil)
+	type key struct{}
+	traced := make(chan interface{}, 1)
+	opts := memoryOptions()
+	opts.TraceEmit = func(info EmitInfo) func(err error) {
+		info.SetContext(context.WithValue(info.Context, key{}, info.Context.Value(key{}).(string)+" traced"))
+		return nil
+	}
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.UseOutgoing(func(p *Packet, next func()) {
+		if p.Type == PacketEvent {
+			traced <- p.Context().Value(key{})
+		}
+		next()
+	})
+	if err := client.EmitContext(context.WithValue(context.Background(), key{}, "caller"), "join"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-traced; got != "caller traced" {
+		t.Errorf("outgoing middleware got %v, want the context of TraceEmit", got)
+	}
+}
+
+func TestFailedHandshakeClosesTransport(t *testing.T) {
+	l, err := ListenMemory(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	closed := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.WriteFrame(MemoryFrame{Data: []byte(`0{"sid":`)})
+		_, err = conn.ReadFrame()
+		closed <- err
+	}()
+	if _, err := NewClient("memory://"+l.name, memoryOptions()); err == nil {
+		t.Fatal("NewClient() = nil, want the handshake error")
+	}
+	select {
+	case err := <-closed:
+		if !errors.Is(err, ErrMemoryClosed) {
+			t.Errorf("server read %v, want ErrMemoryClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the transport of the failed handshake was left open")
+	}
+}
+
+func TestRunAfterClose(t *testing.T) {
+	client, err := NewClient(newMemoryServer(t, nil), memoryOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan error, 1)
+	go func() { ran <- client.Run(context.Background()) }()
+	client.Close()
+	select {
+	case err := <-ran:
+		if err != nil {
+			t.Errorf("Run() = %v after Close, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after Close")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+// benchStats gathers the results of the clients of a bench.
+type benchStats struct {
+	lock          sync.Mutex
+	connects      []time.Duration
+	connectErrors map[string]int
+	emits         int
+	emitErrors    map[string]int
+	acks          []time.Duration
+	disconnects   int
+}
+
+func (s *benchStats) connected(d time.Duration, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.connectErrors[err.Error()]++
+		return
+	}
+	s.connects = append(s.connects, d)
+}
+
+func (s *benchStats) emitted(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.emitErrors[err.Error()]++
+		return
+	}
+	s.emits++
+}
+
+func (s *benchStats) acked(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.acks = append(s.acks, d)
+}
+
+func (s *benchStats) disconnected() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.disconnects++
+}
+
+// pending returns how many emits wait for their ack.
+func (s *benchStats) pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.emits - len(s.acks)
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("socketio-cli bench", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	clients := fs.Int("c", 10, "concurrent clients")
+	rate := fs.Float64("rate", 1, "emits per second of each client")
+	duration := fs.Duration("d", 10*time.Second, "how long the clients emit")
+	event := fs.String("event", "bench", "event emitted")
+	payload := fs.String("args", "[]", "JSON array of the arguments emitted")
+	ack := fs.Bool("ack", true, "emit with an ack callback and measure the ack latency")
+	handshakes := fs.Int("handshakes", 0, "concurrent handshakes at most, 0 for no limit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: socketio-cli bench [flags] uri")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	uri := fs.Arg(0)
+	if *clients <= 0 || *rate <= 0 {
+		return errors.New("bench: -c and -rate must be positive")
+	}
+	var check []json.RawMessage
+	if err := json.Unmarshal([]byte(*payload), &check); err != nil {
+		return fmt.Errorf("bench: -args: %w", err)
+	}
+	opts, err := conn.options()
+	if err != nil {
+		return err
+	}
+	opts.Limiter = socketio_client.NewLimiter(*handshakes, 0)
+
+	stats := &benchStats{
+		connectErrors: make(map[string]int),
+		emitErrors:    make(map[string]int),
+	}
+	interval := time.Duration(float64(time.Second) / *rate)
+	start := time.Now()
+	deadline := start.Add(*duration)
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		open    []*socketio_client.Client
+		closing int32 //disconnections are the bench closing the clients
+	)
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := *opts
+			sent := time.Now()
+			client, err := socketio_client.NewClient(uri, &o)
+			stats.connected(time.Since(sent), err)
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			open = append(open, client)
+			lock.Unlock()
+			client.On("disconnection", func() {
+				if atomic.LoadInt32(&closing) == 0 {
+					stats.disconnected()
+				}
+			})
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for time.Now().Before(deadline) {
+				var cb interface{}
+				if *ack {
+					sent := time.Now()
+					cb = func(args []json.RawMessage) {
+						stats.acked(time.Since(sent))
+					}
+				}
+				stats.emitted(client.EmitPreencoded(*event, []byte(*payload), cb))
+				select {
+				case <-ticker.C:
+				case <-client.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if *ack {
+		// the last acks are still on their way
+		wait := time.Now().Add(conn.ackTimeout)
+		for stats.pending() > 0 && time.Now().Before(wait) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	atomic.StoreInt32(&closing, 1)
+	for _, client := range open {
+		client.Close()
+	}
+	stats.report(os.Stdout, *clients, elapsed, *ack)
+	return nil
+}
+
+func (s *benchStats) report(w io.Writer, clients int, elapsed time.Duration, ack bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fmt.Fprintf(w, "clients:     %d connected, %d failed\n", len(s.connects), clients-len(s.connects))
+	fmt.Fprintf(w, "connect:     %s\n", percentiles(s.connects))
+	fmt.Fprintf(w, "emits:       %d sent, %d failed, %.1f/s\n", s.emits, total(s.emitErrors), float64(s.emits)/elapsed.Seconds())
+	if ack {
+		fmt.Fprintf(w, "acks:        %d received, %d missing\n", len(s.acks), s.emits-len(s.acks))
+		fmt.Fprintf(w, "ack latency: %s\n", percentiles(s.acks))
+	}
+	fmt.Fprintf(w, "disconnects: %d\n", s.disconnects)
+	printErrors(w, "connect", s.connectErrors)
+	printErrors(w, "emit", s.emitErrors)
+}
+
+// percentiles returns the p50, p90, p99 and max of d.
+func percentiles(d []time.Duration) string {
+	if len(d) == 0 {
+		return "-"
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	at := func(p float64) time.Duration {
+		return d[int(p*float64(len(d)-1))].Round(10 * time.Microsecond)
+	}
+	return fmt.Sprintf("p50 %v, p90 %v, p99 %v, max %v", at(0.5), at(0.9), at(0.99), at(1))
+}
+
+func total(errs map[string]int) int {
+	n := 0
+	for _, c := range errs {
+		n += c
+	}
+	return n
+}
+
+func printErrors(w io.Writer, what string, errs map[string]int) {
+	msgs := make([]string, 0, len(errs))
+	for msg := range errs {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+	for _, msg := range msgs {
+		fmt.Fprintf(w, "%s error:  %d × %s\n", what, errs[msg], msg)
+	}
+}
@@ -0,0 +1,320 @@
+// Command socketio-cli is an interactive socket.io client, for debugging
+// servers without writing a program. It connects to the uri, prints the
+// events it receives, and emits those typed on its standard input:
+//
+//	$ socketio-cli -n /chat http://localhost:3000
+//	> emit message "hello" {"room":1}
+//	> ack join "lobby"
+//	> on user.*
+//	> off *
+//
+// Arguments are JSON values separated by spaces.
+//
+// The bench subcommand load tests a server instead: it opens concurrent
+// clients emitting at a steady rate, then reports the connect and ack
+// latencies and the errors:
+//
+//	$ socketio-cli bench -c 200 -rate 5 -d 30s -event ping http://localhost:3000
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+const help = `commands:
+  emit <event> [json...]  emit event with arguments
+  ack <event> [json...]   emit event and wait for its ack
+  on <pattern>            print the events matching pattern, * standing for any run of characters
+  off <pattern>           stop printing the events of a pattern given to on or -on
+  help                    print this help
+  quit                    close the connection and exit`
+
+func main() {
+	run := run
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "bench" {
+		run, args = runBench, args[1:]
+	}
+	if err := run(args); err != nil {
+		fmt.Fprintln(os.Stderr, "socketio-cli:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("socketio-cli", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	var on listFlag
+	fs.Var(&on, "on", "print the events matching this pattern, repeatable; * by default")
+	trace := fs.Bool("trace", false, "print every packet sent and received as it is on the wire")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: socketio-cli [flags] uri")
+		fmt.Fprintln(fs.Output(), "       socketio-cli bench [flags] uri")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), help)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	uri := fs.Arg(0)
+
+	opts, err := conn.options()
+	if err != nil {
+		return err
+	}
+	if len(on) == 0 {
+		on = listFlag{"*"}
+	}
+	out := &printer{w: os.Stdout, patterns: on}
+	if *trace {
+		opts.Tracer = out
+	}
+	client, err := socketio_client.NewClient(uri, opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	out.printf("* connected to %s over %s", uri, client.CurrentTransport())
+
+	client.On("disconnection", func() {
+		out.printf("* disconnected")
+	})
+	client.On("error", func() {
+		out.printf("* error")
+	})
+	client.On("reconnect_attempt", func(attempt int) {
+		out.printf("* reconnecting, attempt %d", attempt)
+	})
+	client.On("reconnect", func(attempt int) {
+		out.printf("* reconnected over %s", client.CurrentTransport())
+	})
+	client.On("reconnect_failed", func() {
+		out.printf("* gave up reconnecting")
+	})
+	client.OnPattern("*", func(ctx context.Context, args []json.RawMessage) {
+		event := socketio_client.EventFromContext(ctx)
+		if out.watched(event) {
+			out.printf("<- %s %s", event, joinArgs(args))
+		}
+	})
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if err := command(client, out, conn.ackTimeout, line); err == errQuit {
+				return nil
+			} else if err != nil {
+				out.printf("! %v", err)
+			}
+		case <-client.Done():
+			return client.Err()
+		}
+	}
+}
+
+var errQuit = errors.New("quit")
+
+// command runs the command typed on line.
+func command(client *socketio_client.Client, out *printer, timeout time.Duration, line string) error {
+	line = strings.TrimSpace(line)
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch name {
+	case "":
+		return nil
+	case "help":
+		out.printf("%s", help)
+		return nil
+	case "quit", "exit":
+		return errQuit
+	case "on":
+		if rest == "" {
+			return errors.New("on: no pattern")
+		}
+		out.watch(rest, true)
+		return nil
+	case "off":
+		if rest == "" {
+			return errors.New("off: no pattern")
+		}
+		out.watch(rest, false)
+		return nil
+	case "emit", "ack":
+	default:
+		return fmt.Errorf("unknown command %q, see help", name)
+	}
+
+	event, rest := rest, ""
+	if i := strings.IndexAny(event, " \t"); i >= 0 {
+		event, rest = event[:i], event[i+1:]
+	}
+	if event == "" {
+		return fmt.Errorf("%s: no event", name)
+	}
+	args, err := parseArgs(rest)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", name, event, err)
+	}
+	payload := []byte(joinArgs(args))
+	if name == "emit" {
+		if err := client.EmitPreencoded(event, payload, nil); err != nil {
+			return err
+		}
+		out.printf("-> %s %s", event, payload)
+		return nil
+	}
+	acks := make(chan []json.RawMessage, 1)
+	sent := time.Now()
+	if err := client.EmitPreencoded(event, payload, func(args []json.RawMessage) {
+		acks <- args
+	}); err != nil {
+		return err
+	}
+	out.printf("-> %s %s", event, payload)
+	select {
+	case args := <-acks:
+		out.printf("<- ack %s in %v", joinArgs(args), time.Since(sent).Round(time.Millisecond))
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("no ack for %s within %v", event, timeout)
+	}
+}
+
+// parseArgs returns the JSON values of s, separated by spaces.
+func parseArgs(s string) ([]json.RawMessage, error) {
+	var args []json.RawMessage
+	dec := json.NewDecoder(strings.NewReader(s))
+	for {
+		var arg json.RawMessage
+		err := dec.Decode(&arg)
+		if err == io.EOF {
+			return args, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+}
+
+// joinArgs returns the JSON array of args.
+func joinArgs(args []json.RawMessage) string {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(arg)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// printer writes the traffic, one timestamped line at a time.
+type printer struct {
+	lock     sync.Mutex
+	w        io.Writer
+	patterns []string
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	fmt.Fprintf(p.w, "%s %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
+
+// watch adds pattern to the printed events, or removes it.
+func (p *printer) watch(pattern string, on bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, q := range p.patterns {
+		if q == pattern {
+			if !on {
+				p.patterns = append(p.patterns[:i], p.patterns[i+1:]...)
+			}
+			return
+		}
+	}
+	if on {
+		p.patterns = append(p.patterns, pattern)
+	}
+}
+
+// watched tells whether event matches one of the printed patterns.
+func (p *printer) watched(event string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, pattern := range p.patterns {
+		if match(pattern, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// match tells whether s matches pattern, in which * stands for any run of
+// characters.
+func match(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+func (p *printer) OnPacketSent(w socketio_client.WirePacket) {
+	p.printf(">> %s%s", w.Payload, attachments(w))
+}
+
+func (p *printer) OnPacketReceived(w socketio_client.WirePacket) {
+	p.printf("<< %s%s", w.Payload, attachments(w))
+}
+
+func attachments(w socketio_client.WirePacket) string {
+	if len(w.Attachments) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" +%d binary", len(w.Attachments))
+}
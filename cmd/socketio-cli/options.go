@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+// listFlag is a flag given any number of times.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// connFlags are the flags telling how to connect, shared by the commands.
+type connFlags struct {
+	namespace  string
+	transports string
+	headers    listFlag
+	query      listFlag
+	insecure   bool
+	reconnect  bool
+	ackTimeout time.Duration
+	verbose    bool
+}
+
+func (f *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.namespace, "n", "", "namespace to join, such as /chat")
+	fs.StringVar(&f.transports, "transport", "", "comma separated transports, such as polling or websocket; polling upgraded to websocket by default")
+	fs.Var(&f.headers, "H", "request header as \"Name: value\", repeatable")
+	fs.Var(&f.query, "q", "query parameter as name=value, repeatable")
+	fs.BoolVar(&f.insecure, "insecure", false, "skip the verification of the TLS certificate of the server")
+	fs.BoolVar(&f.reconnect, "reconnect", true, "reconnect after the connection is lost")
+	fs.DurationVar(&f.ackTimeout, "ack-timeout", 10*time.Second, "how long to wait for acks")
+	fs.BoolVar(&f.verbose, "v", false, "log the internals of the client to stderr")
+}
+
+// options returns the client options set by the flags.
+func (f *connFlags) options() (*socketio_client.Options, error) {
+	opts := &socketio_client.Options{
+		Namespace:          f.namespace,
+		Query:              make(map[string]string),
+		Header:             make(map[string][]string),
+		InsecureSkipVerify: f.insecure,
+		Reconnection:       f.reconnect,
+		AckTimeout:         f.ackTimeout,
+	}
+	if f.transports != "" {
+		opts.Transport = strings.Split(f.transports, ",")
+	}
+	for _, h := range f.headers {
+		i := strings.IndexByte(h, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("header %q: want \"Name: value\"", h)
+		}
+		name := strings.TrimSpace(h[:i])
+		opts.Header[name] = append(opts.Header[name], strings.TrimSpace(h[i+1:]))
+	}
+	for _, q := range f.query {
+		i := strings.IndexByte(q, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("query %q: want name=value", q)
+		}
+		opts.Query[q[:i]] = q[i+1:]
+	}
+	if f.verbose {
+		opts.LogLevel = socketio_client.LogDebug
+	}
+	return opts, nil
+}
@@ -0,0 +1,87 @@
+package socketio_client
+
+import (
+	"bytes"
+	"io/ioutil"
+)
+
+// Codec encodes the arguments of an event otherwise than as JSON, such as
+// with protocol buffers:
+//
+//	type protoCodec struct{}
+//
+//	func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+//		return proto.Marshal(v.(proto.Message))
+//	}
+//
+//	func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+//		return proto.Unmarshal(data, v.(proto.Message))
+//	}
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error // v points to the handler argument
+}
+
+// SetCodec encodes the arguments of event with codec, both those emitted and
+// those passed to its handler, and those of their acks. Each argument
+// travels as a binary attachment. A nil codec brings event back to JSON.
+func (client *Client) SetCodec(event string, codec Codec) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	if codec == nil {
+		delete(client.codecs, event)
+		return
+	}
+	client.codecs[event] = codec
+}
+
+func (client *Client) codec(event string) Codec {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	return client.codecs[event]
+}
+
+// encodeArgs returns args encoded by codec as attachments.
+func encodeArgs(codec Codec, args []interface{}) ([]interface{}, error) {
+	ret := make([]interface{}, len(args))
+	for i, arg := range args {
+		b, err := codec.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = &Attachment{Data: bytes.NewBuffer(b)}
+	}
+	return ret, nil
+}
+
+// decodeArgs decodes the arguments of packet into args, through codec
+// unless it is nil.
+func decodeArgs(decoder *decoder, packet *Packet, codec Codec, args []interface{}) error {
+	if codec == nil {
+		packet.Data = &args
+		return decoder.DecodeData(packet)
+	}
+	attachments := make([]interface{}, len(args))
+	for i := range attachments {
+		attachments[i] = new(Attachment)
+	}
+	packet.Data = &attachments
+	if err := decoder.DecodeData(packet); err != nil {
+		return err
+	}
+	for i, a := range attachments {
+		data := a.(*Attachment).Data
+		if data == nil {
+			// argument not sent
+			continue
+		}
+		b, err := ioutil.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		if err := codec.Unmarshal(b, args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Parser is a wire format of socket.io packets other than the JSON one of
+// the protocol, for servers using a custom parser. Each packet travels as
+// one binary engine.io message, binary data such as []byte arguments being
+// carried by the format itself rather than as attachments. See the
+// cborparser package for one.
+//
+// With a Parser, the raw payloads passed to Options.OnDecodeError and
+// Options.OnUnhandledEvent are the whole messages, and json.RawMessage
+// arguments hold their arguments in the format of the parser.
+type Parser interface {
+	// Encode returns the message carrying p. For events p.Data holds the
+	// event name followed by the arguments, for acks the arguments, as
+	// []interface{}; it is nil for the other packets.
+	Encode(p Packet) ([]byte, error)
+	// Decode returns the packet carried by message, with the elements of
+	// its data still encoded, p.Data being left nil.
+	Decode(message []byte) (p Packet, data [][]byte, err error)
+	// Unmarshal decodes an element returned by Decode into v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// encodeParsed writes v as one binary message encoded by e.parser.
+func (e *encoder) encodeParsed(v Packet) error {
+	if pre, ok := preencodedArgs(v.Data); ok {
+		var args []interface{}
+		if err := json.Unmarshal(pre, &args); err != nil {
+			return err
+		}
+		data := v.Data.([]interface{})
+		v.Data = append(append(data[:1:1], args...), data[2:]...)
+	}
+	if args, ok := v.Data.([]interface{}); ok {
+		// Parser formats carry bytes themselves
+		data := make([]interface{}, len(args))
+		for i, arg := range args {
+			data[i] = arg
+			if a, ok := arg.(*Attachment); ok {
+				b, err := ioutil.ReadAll(a.Data)
+				if err != nil {
+					return err
+				}
+				data[i] = b
+			}
+		}
+		v.Data = data
+	}
+	b, err := e.parser.Encode(v)
+	if err != nil {
+		return err
+	}
+	w, err := e.w.NextWriter(MessageBinary)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// decodeParsed decodes the message d.frame with d.parser.
+func (d *decoder) decodeParsed(ty MessageType, v *Packet) error {
+	if ty != MessageBinary {
+		if d.strict {
+			return d.violation("text frame with a custom parser")
+		}
+		return fmt.Errorf("need binary package")
+	}
+	p, data, err := d.parser.Decode(d.frame)
+	if err != nil {
+		if d.strict {
+			return d.violation(fmt.Sprintf("undecodable packet: %v", err))
+		}
+		return err
+	}
+	v.Type, v.NSP, v.Id = p.Type, p.NSP, p.Id
+	d.size = len(d.frame)
+	d.data = len(d.frame)
+	if data == nil {
+		return nil
+	}
+	args := make([]json.RawMessage, len(data))
+	for i, b := range data {
+		args[i] = b
+	}
+	v.Data = args
+	return d.load(v)
+}
+
+// unmarshalParsed decodes data into v with d.parser, filling attachments
+// from the bytes carried by the format.
+func (d *decoder) unmarshalParsed(data []byte, v interface{}) error {
+	a, ok := v.(*Attachment)
+	if !ok {
+		return d.parser.Unmarshal(data, v)
+	}
+	var b []byte
+	if err := d.parser.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	a.Data = bytes.NewBuffer(b)
+	return nil
+}
@@ -0,0 +1,131 @@
+package socketio_client
+
+import (
+	"runtime"
+	"sync"
+)
+
+// DispatchMode selects how the handlers of incoming events and acks run.
+type DispatchMode int
+
+const (
+	DispatchSerial    DispatchMode = iota //one at a time on the read loop, which waits for them
+	DispatchGoroutine                     //each in its own goroutine
+	DispatchPool                          //on a pool of Options.DispatchWorkers goroutines; the read loop waits when all are busy
+	DispatchPerEvent                      //in arrival order for each event name of a namespace, different events and acks concurrently
+)
+
+// dispatcher runs the handling of incoming packets as configured by
+// Options.Dispatch.
+type dispatcher struct {
+	opts   *Options
+	mode   DispatchMode
+	jobs   chan func()
+	wg     sync.WaitGroup
+	serial sync.Mutex //held by the handler running in DispatchSerial mode
+
+	lock    sync.Mutex
+	queues  map[string][]func() //pending handlers by event, while a goroutine drains them
+	stopped bool
+}
+
+func newDispatcher(opts *Options) *dispatcher {
+	d := &dispatcher{
+		opts:   opts,
+		mode:   opts.Dispatch,
+		queues: make(map[string][]func()),
+	}
+	if d.mode == DispatchPool {
+		workers := opts.DispatchWorkers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		d.jobs = make(chan func(), workers)
+		for i := 0; i < workers; i++ {
+			go d.work(opts)
+		}
+	}
+	return d
+}
+
+func (d *dispatcher) work(opts *Options) {
+	setGoroutineLabels(opts, "handler")
+	for f := range d.jobs {
+		f()
+		d.wg.Done()
+	}
+}
+
+// run calls f as configured, returning once it ran in serial mode. key
+// orders the calls in DispatchPerEvent mode; calls with an empty key are
+// not ordered. It reports false, f not called, once the dispatcher stopped.
+func (d *dispatcher) run(key string, f func()) bool {
+	d.lock.Lock()
+	if d.stopped {
+		d.lock.Unlock()
+		return false
+	}
+	d.wg.Add(1)
+	d.lock.Unlock()
+	switch {
+	case d.mode == DispatchGoroutine, d.mode == DispatchPerEvent && key == "":
+		go labeled(d.opts, func() {
+			defer d.wg.Done()
+			f()
+		}, "handler")()
+	case d.mode == DispatchPool:
+		d.jobs <- f
+	case d.mode == DispatchPerEvent:
+		d.lock.Lock()
+		q, draining := d.queues[key]
+		d.queues[key] = append(q, f)
+		d.lock.Unlock()
+		if !draining {
+			go d.drain(key)
+		}
+	default:
+		defer d.wg.Done()
+		d.serially(f)
+	}
+	return true
+}
+
+// serially calls f once no other handler runs in DispatchSerial mode, such
+// as those of the read loop and the events coalesced by
+// Options.IncomingRateLimit.
+func (d *dispatcher) serially(f func()) {
+	d.serial.Lock()
+	defer d.serial.Unlock()
+	f()
+}
+
+// drain calls the queued handlers of key in order until none is left.
+func (d *dispatcher) drain(key string) {
+	setGoroutineLabels(d.opts, "handler")
+	for {
+		d.lock.Lock()
+		q := d.queues[key]
+		if len(q) == 0 {
+			delete(d.queues, key)
+			d.lock.Unlock()
+			return
+		}
+		f := q[0]
+		d.queues[key] = q[1:]
+		d.lock.Unlock()
+
+		f()
+		d.wg.Done()
+	}
+}
+
+// stop waits for the running handlers and ends the workers.
+func (d *dispatcher) stop() {
+	d.lock.Lock()
+	d.stopped = true
+	d.lock.Unlock()
+	d.wg.Wait()
+	if d.jobs != nil {
+		close(d.jobs)
+	}
+}
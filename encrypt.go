@@ -0,0 +1,58 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// sealArgs returns args sealed by Options.Encrypt: their JSON array,
+// encrypted, as one binary attachment.
+func (client *Client) sealArgs(event string, args []interface{}) ([]interface{}, error) {
+	plain, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := client.opts.Encrypt(event, plain)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{&Attachment{Data: bytes.NewBuffer(sealed)}}, nil
+}
+
+// openArgs returns a decoder of the arguments of the event sealed in the
+// attachment decoded by d, opened by Options.Decrypt.
+func (client *Client) openArgs(event string, d *decoder, packet *Packet) (*decoder, error) {
+	sealed := new(Attachment)
+	if err := decodeArgs(d, packet, nil, []interface{}{sealed}); err != nil {
+		return nil, err
+	}
+	var b []byte
+	if sealed.Data != nil {
+		var err error
+		if b, err = ioutil.ReadAll(sealed.Data); err != nil {
+			return nil, err
+		}
+	}
+	plain, err := client.opts.Decrypt(event, b)
+	if err != nil {
+		return nil, err
+	}
+	return client.argsDecoder(event, plain)
+}
+
+// argsDecoder returns a decoder of the arguments of event held by the JSON
+// array payload.
+func (client *Client) argsDecoder(event string, payload []byte) (*decoder, error) {
+	ret := &decoder{
+		message:               event,
+		frame:                 payload,
+		size:                  len(payload),
+		useNumber:             client.opts.JSONUseNumber,
+		disallowUnknownFields: client.opts.JSONDisallowUnknownFields,
+	}
+	if err := json.Unmarshal(payload, &ret.args); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,139 @@
+package socketio_client
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointPolicy picks the order in which the uri of NewClient and
+// Options.FallbackURLs are tried on each connection attempt.
+type EndpointPolicy int
+
+const (
+	EndpointOrdered    EndpointPolicy = iota //from the first url every time
+	EndpointRoundRobin                       //from the url after the last one connected to
+	EndpointRandom                           //in a random order
+)
+
+// SRVLookup finds the servers in DNS SRV records, such as those of
+// _socketio._tcp.example.com, in place of the host and port of the uri.
+type SRVLookup struct {
+	Service string //such as "socketio"; with Proto empty, Name is looked up as is
+	Proto   string //such as "tcp"
+	Name    string //domain of the records, the host of the uri when empty
+}
+
+// endpoints are the urls a manager connects to.
+type endpoints struct {
+	urls   []*url.URL
+	policy EndpointPolicy
+
+	lock sync.Mutex
+	last int //index of the url last connected to
+}
+
+func newEndpoints(urls []*url.URL, policy EndpointPolicy) *endpoints {
+	return &endpoints{
+		urls:   urls,
+		policy: policy,
+		last:   -1,
+	}
+}
+
+// order returns the indexes of n urls in the order to try them.
+func (e *endpoints) order(n int) []int {
+	ret := make([]int, n)
+	switch e.policy {
+	case EndpointRoundRobin:
+		e.lock.Lock()
+		start := e.last + 1
+		e.lock.Unlock()
+		for i := range ret {
+			ret[i] = (start + i) % n
+		}
+	case EndpointRandom:
+		ret = rand.Perm(n)
+	default:
+		for i := range ret {
+			ret[i] = i
+		}
+	}
+	return ret
+}
+
+// dial opens a connection to the first url of the order that accepts it,
+// returning the error of the last one when none does. With SRV records,
+// the servers they list replace the uri and are looked up again on every
+// call. A non zero deadline bounds all the attempts together, each one
+// being bounded by Options.ConnectTimeout otherwise.
+func (e *endpoints) dial(ctx context.Context, opts *Options, jar http.CookieJar, log Logger, deadline time.Time) (conn *clientConn, err error) {
+	urls := e.urls
+	if opts.SRV != nil {
+		lookupCtx := ctx
+		if !deadline.IsZero() {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		targets, err := lookupSRV(lookupCtx, opts, e.urls[0])
+		if err != nil {
+			return nil, classifyConnectError(err)
+		}
+		urls = append(targets, e.urls[1:]...)
+	}
+	for _, i := range e.order(len(urls)) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, connectTimeout(opts)
+		}
+		conn, err = newClientConn(ctx, opts, urls[i], jar, deadline)
+		if err == nil {
+			e.lock.Lock()
+			e.last = i
+			e.lock.Unlock()
+			return conn, nil
+		}
+		if len(urls) > 1 {
+			log.Infof("socket.io %s: connection failed: %v", redactURL(urls[i]), err)
+		}
+	}
+	return nil, err
+}
+
+// lookupSRV returns u pointed at each server of the SRV records of
+// opts.SRV, by priority and weight.
+func lookupSRV(ctx context.Context, opts *Options, u *url.URL) ([]*url.URL, error) {
+	resolver := opts.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	name := opts.SRV.Name
+	if name == "" {
+		name = u.Hostname()
+	}
+	if opts.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ConnectTimeout)
+		defer cancel()
+	}
+	_, records, err := resolver.LookupSRV(ctx, opts.SRV.Service, opts.SRV.Proto, name)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*url.URL, 0, len(records))
+	for _, r := range records {
+		target := *u
+		target.Host = net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port)))
+		ret = append(ret, &target)
+	}
+	return ret, nil
+}
@@ -0,0 +1,118 @@
+package socketio_client
+
+import (
+	"io"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EngineConn is a bare engine.io connection, for servers spoken to without
+// the socket.io layer. It handshakes, pings and upgrades to websocket as
+// the connection of a Client does, with the same Options, those of the
+// socket.io layer aside, and carries the messages as they are. It does not
+// reconnect.
+type EngineConn struct {
+	conn *clientConn
+}
+
+// DialEngine opens an engine.io connection to uri, such as
+// "http://localhost:8080/engine.io/". An uri without a path connects to
+// /engine.io/. The connection is closed once Options.Context is canceled.
+// A nil opts connects with the default options.
+func DialEngine(uri string, opts *Options) (*EngineConn, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	u, err := engineURL(uri, opts)
+	if err != nil {
+		return nil, err
+	}
+	jar := opts.Jar
+	if jar == nil {
+		jar, _ = cookiejar.New(nil)
+	}
+	conn, err := newClientConn(optionsContext(opts), opts, u, jar, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return &EngineConn{conn: conn}, nil
+}
+
+// engineURL returns the engine.io url of the server at uri.
+func engineURL(uri string, opts *Options) (*url.URL, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/engine.io/"
+	} else if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	query := url.Values{"EIO": {"3"}}
+	for k, v := range opts.Query {
+		query.Set(k, v)
+	}
+	u.RawQuery = mergeQuery(mergeQuery(u.RawQuery, query), opts.QueryValues)
+	return u, nil
+}
+
+// ID returns the session id given by the server.
+func (e *EngineConn) ID() string {
+	return e.conn.Id()
+}
+
+// Transport returns the name of the transport in use, "polling" until the
+// upgrade to "websocket" is done.
+func (e *EngineConn) Transport() string {
+	return e.conn.transportName()
+}
+
+// Handshake returns the settings advertised by the server on opening.
+func (e *EngineConn) Handshake() *Handshake {
+	return e.conn.handshake
+}
+
+// Response returns the HTTP response to the open request.
+func (e *EngineConn) Response() *HandshakeResponse {
+	return e.conn.response
+}
+
+// NextReader returns the next message from the server, to be closed once
+// read. Messages arriving meanwhile are buffered as told by
+// Options.IncomingBuffer. It fails once the connection is closed, with the
+// error of Err.
+func (e *EngineConn) NextReader() (MessageType, io.ReadCloser, error) {
+	return e.conn.NextReader()
+}
+
+// NextWriter returns a writer of a message of type t, sent once closed.
+// Other writes wait until it is closed. It fails once the connection is
+// closed, or when an upgrade takes longer than Options.UpgradeWait.
+func (e *EngineConn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	return e.conn.NextWriter(t)
+}
+
+// Done returns a channel closed once the connection is closed.
+func (e *EngineConn) Done() <-chan struct{} {
+	return e.conn.done
+}
+
+// Err returns nil until Done is closed, and then ErrClosed, wrapping why
+// when the connection was lost.
+func (e *EngineConn) Err() error {
+	select {
+	case <-e.conn.done:
+		return e.conn.closeErr()
+	default:
+		return nil
+	}
+}
+
+// Close sends the engine.io CLOSE packet and closes the connection. It can
+// be called any number of times.
+func (e *EngineConn) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,108 @@
+package socketio_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+)
+
+// ErrEngineOnly is returned by the socket.io methods of a client with
+// Options.EngineOnly, such as Emit, and by Send without it.
+var ErrEngineOnly = errors.New("engine.io only client")
+
+var (
+	bytesType       = reflect.TypeOf([]byte(nil))
+	messageTypeType = reflect.TypeOf(MessageText)
+)
+
+// Send writes data as one raw engine.io message with Options.EngineOnly: a
+// string as a text message, a []byte as a binary one.
+func (client *Client) Send(data interface{}) error {
+	if !client.opts.EngineOnly {
+		return ErrEngineOnly
+	}
+	var (
+		typ MessageType
+		b   []byte
+	)
+	switch v := data.(type) {
+	case string:
+		typ, b = MessageText, []byte(v)
+	case []byte:
+		typ, b = MessageBinary, v
+	default:
+		return fmt.Errorf("cannot send %T, only string and []byte", data)
+	}
+	conn, _ := client.manager.connection()
+	w, err := conn.NextWriter(typ)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// readEngine passes the messages of conn to the "message" handler of the
+// client of the manager until the connection ends.
+func (m *manager) readEngine(conn *clientConn) error {
+	for {
+		typ, r, err := conn.NextReader()
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		client := m.client("")
+		if client == nil {
+			continue
+		}
+		if m.dispatcher.mode == DispatchSerial {
+			client.onEngineMessage(typ, data)
+			continue
+		}
+		m.dispatcher.run("", func() {
+			client.onEngineMessage(typ, data)
+		})
+	}
+}
+
+// onEngineMessage calls the "message" handler with a raw message. Its
+// arguments get the message as a string or a []byte, its MessageType, or
+// else the message decoded as JSON.
+func (client *Client) onEngineMessage(typ MessageType, data []byte) {
+	const event = "message"
+	c, ok := client.handler(event)
+	if !ok {
+		client.manager.log.Debugf("engine.io: no handler for %q", event)
+		return
+	}
+	args := c.GetArgs(1)
+	for _, arg := range args {
+		v := reflect.ValueOf(arg).Elem()
+		switch {
+		case v.Type() == messageTypeType:
+			v.Set(reflect.ValueOf(typ))
+		case v.Kind() == reflect.String:
+			v.SetString(string(data))
+		case v.Type() == bytesType:
+			v.SetBytes(data)
+		default:
+			if err := json.Unmarshal(data, arg); err != nil {
+				if f := client.opts.OnDecodeError; f != nil {
+					f(event, data, err)
+				}
+				client.manager.log.Errorf("engine.io: message: %v", err)
+				return
+			}
+		}
+	}
+	client.invoke(nil, event, c, args)
+}
@@ -0,0 +1,144 @@
+package socketio_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Classes of connection failures returned by NewClient and passed to the
+// "reconnect_error" handler, to be tested with errors.Is.
+var (
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrServerUnavailable = errors.New("server unavailable")
+	ErrBadHandshake      = errors.New("bad handshake")
+	ErrTransportRefused  = errors.New("transport refused by server")
+	ErrConnectTimeout    = errors.New("connect timeout")
+	ErrNamespaceRefused  = errors.New("namespace connect refused")
+)
+
+// Failures of an open connection, to be tested with errors.Is. Emits on a
+// closed connection fail with ErrClosed, wrapping why it closed, such as
+// ErrPingTimeout; Options.OnUpgradeError gets ErrUpgradeFailed.
+var (
+	ErrClosed        = errors.New("connection closed")
+	ErrUpgradeFailed = errors.New("transport upgrade failed")
+	ErrPingTimeout   = errors.New("ping timeout")
+	// ErrReconnectFailed is returned by Client.Err once reconnecting was
+	// given up after Options.ReconnectionAttempts.
+	ErrReconnectFailed = errors.New("reconnect failed")
+)
+
+// ErrUnhandledEvent is returned, wrapped with the event name, for events
+// without a handler when Options.StrictEvents is set.
+var ErrUnhandledEvent = errors.New("no handler for event")
+
+// engine.io error codes answered with a 400 status
+const (
+	engineTransportUnknown = 0
+	engineForbidden        = 4
+)
+
+// classError tags a failure with its class.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+func (e *classError) Is(target error) bool {
+	return target == e.class
+}
+
+// closedOnPurpose tells whether err, returned by Client.Err, is ErrClosed
+// for a close on purpose, rather than wrapping why the connection was lost.
+func closedOnPurpose(err error) bool {
+	if !errors.Is(err, ErrClosed) {
+		return false
+	}
+	var class *classError
+	if !errors.As(err, &class) {
+		return true
+	}
+	return errors.Is(class.err, context.Canceled) || errors.Is(class.err, context.DeadlineExceeded)
+}
+
+// connectTimeout returns the error of a connect that took longer than
+// Options.ConnectTimeout.
+func connectTimeout(opts *Options) error {
+	return &classError{
+		class: ErrConnectTimeout,
+		err:   fmt.Errorf("connect timeout after %v", opts.ConnectTimeout),
+	}
+}
+
+// classifyConnectError tags err with the class of failure it belongs to.
+func classifyConnectError(err error) error {
+	var class error
+	var handshakeErr *HandshakeError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &handshakeErr):
+		class = handshakeClass(handshakeErr.Response)
+	case errors.As(err, &netErr):
+		class = ErrServerUnavailable
+	default:
+		return err
+	}
+	return &classError{class: class, err: err}
+}
+
+func handshakeClass(resp *HandshakeResponse) error {
+	if resp == nil {
+		// the transport gave no response, or no valid open packet
+		return ErrBadHandshake
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrServerUnavailable
+	case http.StatusBadRequest:
+		var body struct {
+			Code *int `json:"code"`
+		}
+		if json.Unmarshal(resp.Body, &body) == nil && body.Code != nil {
+			switch *body.Code {
+			case engineTransportUnknown:
+				return ErrTransportRefused
+			case engineForbidden:
+				return ErrUnauthorized
+			}
+		}
+	}
+	return ErrBadHandshake
+}
+
+// ResourceExhaustedError is returned when a connection could not be made
+// because the process or the system ran out of file descriptors.
+type ResourceExhaustedError struct {
+	Err error
+}
+
+func (e *ResourceExhaustedError) Error() string {
+	return "resource exhausted: " + e.Err.Error()
+}
+
+func (e *ResourceExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+func isResourceExhausted(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
@@ -0,0 +1,54 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandshakeClass(t *testing.T) {
+	tests := []struct {
+		resp *HandshakeResponse
+		want error
+	}{
+		{nil, ErrBadHandshake},
+		{&HandshakeResponse{StatusCode: http.StatusForbidden}, ErrUnauthorized},
+		{&HandshakeResponse{StatusCode: http.StatusServiceUnavailable}, ErrServerUnavailable},
+		{&HandshakeResponse{StatusCode: http.StatusBadRequest, Body: []byte(`{"code":0}`)}, ErrTransportRefused},
+		{&HandshakeResponse{StatusCode: http.StatusOK}, ErrBadHandshake},
+	}
+	for _, tt := range tests {
+		if got := handshakeClass(tt.resp); got != tt.want {
+			t.Errorf("handshakeClass(%+v) = %v, want %v", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyConnectErrorWithoutResponse(t *testing.T) {
+	err := classifyConnectError(&HandshakeError{Err: errors.New("invalid open packet")})
+	if !errors.Is(err, ErrBadHandshake) {
+		t.Fatalf("classifyConnectError() = %v, want ErrBadHandshake", err)
+	}
+}
+
+func TestClosedOnPurpose(t *testing.T) {
+	lost := fmt.Errorf("engine.io sid: %w", ErrPingTimeout)
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrClosed, true},
+		{&classError{class: ErrClosed, err: context.Canceled}, true},
+		{&classError{class: ErrClosed, err: fmt.Errorf("engine.io sid: %w", context.Canceled)}, true},
+		{&classError{class: ErrClosed, err: lost}, false},
+		{ErrReconnectFailed, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := closedOnPurpose(tt.err); got != tt.want {
+			t.Errorf("closedOnPurpose(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//go:build go1.23
+
+package socketio_client
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+)
+
+// Event is an event received through Client.Events.
+type Event struct {
+	Name string
+	Args []json.RawMessage //the arguments, undecoded
+
+	opts *Options
+}
+
+// Decode decodes the arguments of e in order into the values v points to,
+// as if they were handler arguments. Arguments beyond v are ignored.
+func (e Event) Decode(v ...interface{}) error {
+	d := &decoder{
+		parser:                e.opts.Parser,
+		useNumber:             e.opts.JSONUseNumber,
+		disallowUnknownFields: e.opts.JSONDisallowUnknownFields,
+	}
+	for i, arg := range e.Args {
+		if i >= len(v) {
+			break
+		}
+		if err := d.unmarshal(arg, v[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns the events named event as they arrive, until ctx is done,
+// the client is closed or the loop over them stops:
+//
+//	for ev := range client.Events(ctx, "chat") {
+//		var msg string
+//		if err := ev.Decode(&msg); err != nil {
+//			...
+//		}
+//	}
+//
+// While the loop runs it replaces the handler of event set with On, which
+// is put back once it ends; an event caught as the loop ends is dropped.
+// Each event waits for the loop to take it, like for a slow handler.
+func (client *Client) Events(ctx context.Context, event string) iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		events := make(chan Event)
+		stop := make(chan struct{})
+		defer close(stop)
+		c, err := newCaller(func(args []json.RawMessage) {
+			select {
+			case events <- Event{Name: event, Args: args, opts: client.opts}:
+			case <-stop:
+			}
+		})
+		if err != nil {
+			return
+		}
+
+		client.eventsLock.Lock()
+		prev, ok := client.events[event]
+		client.events[event] = c
+		client.eventsLock.Unlock()
+		defer func() {
+			client.eventsLock.Lock()
+			defer client.eventsLock.Unlock()
+			if client.events[event] != c {
+				// replaced meanwhile
+				return
+			}
+			if ok {
+				client.events[event] = prev
+			} else {
+				delete(client.events, event)
+			}
+		}()
+
+		for {
+			select {
+			case ev := <-events:
+				if !yield(ev) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-client.manager.ctx.Done():
+				return
+			}
+		}
+	}
+}
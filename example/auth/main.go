@@ -1,27 +1,37 @@
 package main
 
 import (
-	"github.com/h2570su/go-socket.io-client"
-	"log"
 	"bufio"
+	"flag"
+	"log"
 	"os"
 	"time"
+
+	"github.com/h2570su/go-socket.io-client"
+	"github.com/h2570su/go-socket.io-client/sockettest"
 )
 
 func main() {
+	uri := flag.String("url", "", "socket.io server, a local echo server when empty")
+	flag.Parse()
+
+	if *uri == "" {
+		srv := sockettest.NewServer()
+		defer srv.Close()
+		*uri = srv.URL
+	}
 
 	opts := &socketio_client.Options{
-		//Transport:"polling",
-		Transport:"websocket",
-		Query:make(map[string]string),
+		//Transport: []string{"polling"},
+		Transport: []string{"websocket"},
+		Query:     make(map[string]string),
 	}
 	opts.Query["uid"] = "1"
 	opts.Query["cid"] = "conf_123"
-	uri := "http://192.168.1.70:9090"
 
-	client,err := socketio_client.NewClient(uri,opts)
+	client, err := socketio_client.NewClient(*uri, opts)
 	if err != nil {
-		log.Printf("NewClient error:%v\n",err)
+		log.Printf("NewClient error:%v\n", err)
 		return
 	}
 
@@ -34,6 +44,9 @@ func main() {
 	client.On("message", func(msg string) {
 		log.Printf("on message:%v\n", msg)
 	})
+	client.On("authenticate", func(msg string) {
+		log.Printf("on authenticate:%v\n", msg)
+	})
 	client.On("disconnection", func() {
 		log.Printf("on disconnect\n")
 	})
@@ -43,21 +56,24 @@ func main() {
 		for {
 			err := client.Emit("authenticate", authStr)
 			if err != nil {
-				log.Printf("Emit auth error:%v\n",err)
+				log.Printf("Emit auth error:%v\n", err)
 			}
 			time.Sleep(10 * time.Second)
 		}
 	}()
 
 	reader := bufio.NewReader(os.Stdin)
-	for  {
-		data, _, _ := reader.ReadLine()
+	for {
+		data, _, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
 		command := string(data)
-		err := client.Emit("message",command)
+		err = client.Emit("message", command)
 		if err != nil {
-			log.Printf("Emit message error:%v\n",err)
+			log.Printf("Emit message error:%v\n", err)
 			continue
 		}
-		log.Printf("send message:%v\n",command)
+		log.Printf("send message:%v\n", command)
 	}
-}
\ No newline at end of file
+}
@@ -2,23 +2,33 @@ package main
 
 import (
 	"bufio"
-	"github.com/h2570su/go-socket.io-client"
+	"flag"
 	"log"
 	"os"
+
+	"github.com/h2570su/go-socket.io-client"
+	"github.com/h2570su/go-socket.io-client/sockettest"
 )
 
 func main() {
+	uri := flag.String("url", "", "socket.io server, a local echo server when empty")
+	flag.Parse()
+
+	if *uri == "" {
+		srv := sockettest.NewServer()
+		defer srv.Close()
+		*uri = srv.URL
+	}
 
 	opts := &socketio_client.Options{
-		//Transport:"polling",
-		Transport:"websocket",
+		//Transport: []string{"polling"},
+		Transport: []string{"websocket"},
 		Query:     make(map[string]string),
 	}
 	opts.Query["user"] = "user"
 	opts.Query["pwd"] = "pass"
-	uri := "http://192.168.1.70:9090"
 
-	client, err := socketio_client.NewClient(uri, opts)
+	client, err := socketio_client.NewClient(*uri, opts)
 	if err != nil {
 		log.Printf("NewClient error:%v\n", err)
 		return
@@ -39,7 +49,10 @@ func main() {
 
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		data, _, _ := reader.ReadLine()
+		data, _, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
 		command := string(data)
 		client.Emit("message", command)
 		log.Printf("send message:%v\n", command)
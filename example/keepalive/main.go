@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/h2570su/go-socket.io-client"
+	"github.com/h2570su/go-socket.io-client/sockettest"
+)
+
+type Register struct {
+	PeerId string `json:"peerId"`
+}
+
+type RegisterRsp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// handlers handles the events named after its methods
+type handlers struct{}
+
+func (handlers) KeepaliveRsp() {
+	fmt.Println("-------")
+}
+
+// the local echo server sends keepalive back
+func (handlers) Keepalive(r Register) {
+	fmt.Println("keepalive", r.PeerId)
+}
+
+func main() {
+	uri := flag.String("url", "", "socket.io server, a local echo server when empty")
+	flag.Parse()
+
+	if *uri == "" {
+		srv := sockettest.NewServer()
+		defer srv.Close()
+		*uri = srv.URL
+	}
+
+	opts := &socketio_client.Options{
+		Transport: []string{"websocket"},
+	}
+	client, err := socketio_client.NewClient(*uri, opts)
+	if err != nil {
+		log.Printf("NewClient error:%v\n", err)
+		return
+	}
+	if err := client.RegisterHandlers(handlers{}); err != nil {
+		log.Printf("RegisterHandlers error:%v\n", err)
+		return
+	}
+	r := Register{PeerId: "111"}
+	client.Emit("keepalive", &r, func(rsp Register) {
+		fmt.Println("ack", rsp.PeerId)
+	})
+	time.Sleep(time.Second)
+	client.Close()
+}
@@ -0,0 +1,33 @@
+package socketio_client
+
+// OnEvent registers fn as the handler of event, decoding the first argument
+// of the event into T.
+func OnEvent[T any](c *Client, event string, fn func(T)) error {
+	return c.On(event, fn)
+}
+
+// EmitWithAck emits event with req and waits for the ack, decoding its
+// first argument into TResp. It waits at most Options.AckTimeout, failing
+// with ErrAckTimeout, and forever when that is 0. It fails with ErrClosed
+// once the client is closed.
+func EmitWithAck[TReq, TResp any](c *Client, event string, req TReq) (TResp, error) {
+	type result struct {
+		resp TResp
+		err  error
+	}
+	done := make(chan result, 1)
+	err := c.Emit(event, req, func(resp TResp, err error) {
+		done <- result{resp, err}
+	})
+	if err != nil {
+		var zero TResp
+		return zero, err
+	}
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-c.Done():
+		var zero TResp
+		return zero, c.Err()
+	}
+}
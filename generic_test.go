@@ -0,0 +1,38 @@
+package socketio_client
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmitWithAckClosed(t *testing.T) {
+	received := make(chan struct{}, 1)
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		// events are never acknowledged
+		if bytes.HasPrefix(f.Data, []byte("42")) {
+			received <- struct{}{}
+		}
+		return false
+	})
+	client, err := NewClient(uri, memoryOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := EmitWithAck[string, string](client, "question", "?")
+		errs <- err
+	}()
+	<-received
+	client.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("EmitWithAck() error = %v, want ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("EmitWithAck still waiting after Close")
+	}
+}
@@ -1,11 +1,26 @@
 module github.com/h2570su/go-socket.io-client
 
-go 1.13
+go 1.18
 
 require (
-	github.com/gorilla/websocket v1.4.2 // indirect
-	github.com/sirupsen/logrus v1.5.0
-	github.com/smartystreets/goconvey v1.6.4 // indirect
-	github.com/stretchr/testify v1.3.0 // indirect
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/prometheus/client_golang v1.11.1
 	github.com/zhouhui8915/engine.io-go v0.0.0-20150910083302-02ea08f0971f
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.26.0 // indirect
+	github.com/prometheus/procfs v0.6.0 // indirect
+	github.com/smartystreets/goconvey v1.6.4 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.0.0-20210603081109-ebe580a85c40 // indirect
+	google.golang.org/protobuf v1.26.0-rc.1 // indirect
 )
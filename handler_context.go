@@ -0,0 +1,48 @@
+package socketio_client
+
+import (
+	"context"
+	"reflect"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+type clientKey struct{}
+
+// ClientFromContext returns the client whose handler got ctx, nil when ctx
+// does not come from a handler.
+func ClientFromContext(ctx context.Context) *Client {
+	client, _ := ctx.Value(clientKey{}).(*Client)
+	return client
+}
+
+// optionsContext returns the root context of the connections made with
+// opts.
+func optionsContext(opts *Options) context.Context {
+	if opts.Context != nil {
+		return opts.Context
+	}
+	return context.Background()
+}
+
+// handlerContext returns the context passed to handlers taking one, which
+// is canceled once the connection is lost or the client closed.
+func (client *Client) handlerContext() context.Context {
+	client.ctxLock.Lock()
+	defer client.ctxLock.Unlock()
+	if client.ctx == nil {
+		client.ctx, client.cancel = context.WithCancel(context.WithValue(optionsContext(client.opts), clientKey{}, client))
+	}
+	return client.ctx
+}
+
+// cancelContext cancels the context of the handlers still running, the
+// next handlers getting a new one.
+func (client *Client) cancelContext() {
+	client.ctxLock.Lock()
+	defer client.ctxLock.Unlock()
+	if client.cancel != nil {
+		client.cancel()
+	}
+	client.ctx, client.cancel = nil, nil
+}
@@ -0,0 +1,182 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Handshake holds the settings advertised by the server in the engine.io
+// open packet. It is shared between connections and must not be modified.
+type Handshake struct {
+	Upgrades     []string
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	MaxPayload   int64
+}
+
+type openPacket struct {
+	Sid          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int64    `json:"pingInterval"`
+	PingTimeout  int64    `json:"pingTimeout"`
+	MaxPayload   int64    `json:"maxPayload"`
+}
+
+// canUpgrade reports whether the server advertised transport as an upgrade.
+func (h *Handshake) canUpgrade(transport string) bool {
+	for _, t := range h.Upgrades {
+		if t == transport {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHandshake(b []byte) (string, *Handshake, error) {
+	var msg openPacket
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return "", nil, err
+	}
+	return msg.Sid, &Handshake{
+		Upgrades:     msg.Upgrades,
+		PingInterval: time.Duration(msg.PingInterval) * time.Millisecond,
+		PingTimeout:  time.Duration(msg.PingTimeout) * time.Millisecond,
+		MaxPayload:   msg.MaxPayload,
+	}, nil
+}
+
+// HandshakeResponse describes the HTTP response to the engine.io open
+// request.
+type HandshakeResponse struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte // start of the body, only kept when the handshake failed
+}
+
+func newHandshakeResponse(resp *http.Response, body []byte) *HandshakeResponse {
+	if resp == nil {
+		return nil
+	}
+	return &HandshakeResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}
+}
+
+// HandshakeError is returned when the server answered the open request
+// with an error status or without a valid open packet.
+type HandshakeError struct {
+	Response *HandshakeResponse
+	Err      error
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Response == nil {
+		// no response to tell about, such as from a custom transport
+		return fmt.Sprintf("handshake failed: %v", e.Err)
+	}
+	return fmt.Sprintf("handshake failed (%s): %v", e.Response.Status, e.Err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// HandshakeCache shares handshake settings between clients connecting to the
+// same origin, such as a fleet behind one load balancer. Set it as
+// Options.HandshakeCache on every client that should use it. An open packet
+// the same as the one the settings were parsed from, but for its session
+// id, is not parsed again.
+type HandshakeCache struct {
+	lock    sync.RWMutex
+	entries map[string]*Handshake
+	raw     map[string][]byte //open packet of each entry, its session id cut out
+}
+
+func NewHandshakeCache() *HandshakeCache {
+	return &HandshakeCache{
+		entries: make(map[string]*Handshake),
+		raw:     make(map[string][]byte),
+	}
+}
+
+// Get returns the settings last advertised by origin, or nil.
+func (c *HandshakeCache) Get(origin string) *Handshake {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.entries[origin]
+}
+
+// All returns the settings of every origin seen so far.
+func (c *HandshakeCache) All() map[string]*Handshake {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	ret := make(map[string]*Handshake, len(c.entries))
+	for k, v := range c.entries {
+		ret[k] = v
+	}
+	return ret
+}
+
+// lookup returns the session id of the open packet b and the settings
+// cached for origin, when they were parsed from the same packet but for its
+// session id. It returns nil settings otherwise.
+func (c *HandshakeCache) lookup(origin string, b []byte) (string, *Handshake) {
+	sid, rest, ok := cutSid(b)
+	if !ok {
+		return "", nil
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if !bytes.Equal(c.raw[origin], rest) {
+		return "", nil
+	}
+	return sid, c.entries[origin]
+}
+
+// store records hs, parsed from the open packet b, for origin and returns
+// the cached entry instead when the server advertised the same settings as
+// before.
+func (c *HandshakeCache) store(origin string, b []byte, hs *Handshake) *Handshake {
+	_, rest, _ := cutSid(b)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cached := c.entries[origin]; cached != nil && reflect.DeepEqual(cached, hs) {
+		hs = cached
+	}
+	c.entries[origin] = hs
+	c.raw[origin] = rest
+	return hs
+}
+
+// cutSid returns the session id of the open packet b and b without it. It
+// reports false, b being left to json.Unmarshal, unless the id is written
+// plainly.
+func cutSid(b []byte) (string, []byte, bool) {
+	const key = `"sid":"`
+	i := bytes.Index(b, []byte(key))
+	if i < 0 {
+		return "", nil, false
+	}
+	start := i + len(key)
+	n := bytes.IndexByte(b[start:], '"')
+	if n < 0 || bytes.IndexByte(b[start:start+n], '\\') >= 0 {
+		return "", nil, false
+	}
+	rest := make([]byte, 0, len(b)-n)
+	rest = append(append(rest, b[:start]...), b[start+n:]...)
+	return string(b[start : start+n]), rest, true
+}
+
+func handshakeOrigin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
@@ -0,0 +1,63 @@
+package socketio_client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHandshakeErrorWithoutResponse(t *testing.T) {
+	err := &HandshakeError{Err: errors.New("invalid open packet")}
+	if got, want := err.Error(), "handshake failed: invalid open packet"; got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestHandshakeErrorWithResponse(t *testing.T) {
+	err := &HandshakeError{
+		Response: &HandshakeResponse{StatusCode: 403, Status: "403 Forbidden"},
+		Err:      errors.New("refused"),
+	}
+	if got, want := err.Error(), "handshake failed (403 Forbidden): refused"; got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestHandshakeCacheLookup(t *testing.T) {
+	open := func(sid string, interval int) []byte {
+		return []byte(fmt.Sprintf(`{"sid":"%s","upgrades":["websocket"],"pingInterval":%d,"pingTimeout":20000}`, sid, interval))
+	}
+	c := NewHandshakeCache()
+	const origin = "http://example.com/socket.io/"
+	if _, hs := c.lookup(origin, open("a", 25000)); hs != nil {
+		t.Fatalf("lookup() = %+v on an empty cache", hs)
+	}
+	_, parsed, err := parseHandshake(open("a", 25000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := c.store(origin, open("a", 25000), parsed)
+
+	tests := []struct {
+		b      []byte
+		sid    string
+		cached bool
+	}{
+		{open("b", 25000), "b", true},
+		{open("c", 30000), "", false},
+		{open(`d\u0041`, 25000), "", false}, // escaped, parsed instead
+		{[]byte(`{"upgrades":[],"pingInterval":25000}`), "", false},
+	}
+	for _, tt := range tests {
+		sid, hs := c.lookup(origin, tt.b)
+		if tt.cached && (hs != stored || sid != tt.sid) {
+			t.Errorf("lookup(%s) = %q, %p, want %q, %p", tt.b, sid, hs, tt.sid, stored)
+		}
+		if !tt.cached && hs != nil {
+			t.Errorf("lookup(%s) = %+v, want nil", tt.b, hs)
+		}
+	}
+	if _, hs := c.lookup("http://other.example.com/socket.io/", open("e", 25000)); hs != nil {
+		t.Errorf("lookup() of another origin = %+v, want nil", hs)
+	}
+}
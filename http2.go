@@ -0,0 +1,28 @@
+package socketio_client
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// HTTP2Mode tells when the polling transport speaks HTTP/2, with which its
+// long-poll GETs and POSTs share one connection to the server.
+type HTTP2Mode int
+
+const (
+	HTTP2Auto      HTTP2Mode = iota //negotiated with https servers, HTTP/1.1 with the others, as net/http does
+	HTTP2Disabled                   //HTTP/1.1 only
+	HTTP2Cleartext                  //HTTP/2 for every request, without TLS (h2c with prior knowledge) on http urls; needs Go 1.24
+)
+
+// setHTTP2 makes t speak HTTP/2 as told by mode.
+func setHTTP2(t *http.Transport, mode HTTP2Mode) error {
+	switch mode {
+	case HTTP2Disabled:
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case HTTP2Cleartext:
+		return setCleartextHTTP2(t)
+	}
+	return nil
+}
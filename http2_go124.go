@@ -0,0 +1,13 @@
+//go:build go1.24
+
+package socketio_client
+
+import "net/http"
+
+func setCleartextHTTP2(t *http.Transport) error {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	t.Protocols = protocols
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !go1.24
+
+package socketio_client
+
+import (
+	"errors"
+	"net/http"
+)
+
+func setCleartextHTTP2(t *http.Transport) error {
+	return errors.New("HTTP2Cleartext needs Go 1.24")
+}
@@ -0,0 +1,197 @@
+package socketio_client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/h2570su/go-socket.io-client/packet"
+)
+
+// ErrIncomingOverflow is passed to Options.OnIncomingOverflow when a
+// message did not fit in the incoming buffer.
+var ErrIncomingOverflow = errors.New("incoming buffer full")
+
+// defaultIncomingBuffer is the size of the incoming buffer when
+// Options.IncomingBuffer is not set.
+const defaultIncomingBuffer = 64
+
+func incomingBuffer(opts *Options) int {
+	if opts.IncomingBuffer > 0 {
+		return opts.IncomingBuffer
+	}
+	return defaultIncomingBuffer
+}
+
+// IncomingPolicy decides what happens to a message arriving while the
+// incoming buffer is full. The drop policies only drop whole events,
+// binary attachments included: other packets, such as acks and namespace
+// connects, wait for room as with IncomingBlock.
+type IncomingPolicy int
+
+const (
+	IncomingBlock      IncomingPolicy = iota //wait for room, holding up the transport
+	IncomingDropOldest                       //drop the oldest buffered event
+	IncomingDropNewest                       //drop the arriving event
+	IncomingClose                            //close the connection
+)
+
+// incomingFrame is an engine.io message waiting to be decoded. Under the
+// drop policies, the attachments of a binary packet are queued with it, so
+// a packet is dropped or kept as a whole.
+type incomingFrame struct {
+	typ         MessageType
+	r           io.ReadCloser
+	attachments []*incomingFrame //binary frames following the packet
+	want        int              //attachments announced by the packet
+	event       bool             //a whole EVENT packet, the only ones the drop policies drop
+}
+
+func (f *incomingFrame) Close() {
+	f.r.Close()
+	for _, a := range f.attachments {
+		a.r.Close()
+	}
+}
+
+// queueMessage copies the message read from r into the incoming buffer,
+// applying Options.IncomingPolicy when it is full.
+func (c *clientConn) queueMessage(typ MessageType, r io.Reader) {
+	max := c.options.MaxPayload
+	if max > 0 {
+		r = io.LimitReader(r, int64(max)+1)
+	}
+	buf := getBuffer()
+	if _, err := buf.ReadFrom(r); err != nil {
+		putBuffer(buf)
+		return
+	}
+	if max > 0 && buf.Len() > max {
+		putBuffer(buf)
+		c.log.Errorf("engine.io %s: message over %d bytes, closing", c.id, max)
+		c.shutdown(false, fmt.Errorf("%w: message over %d bytes", ErrPayloadTooLarge, max))
+		return
+	}
+	frame := &incomingFrame{typ: typ, r: &pooledReader{buf: buf}}
+	switch c.options.IncomingPolicy {
+	case IncomingDropOldest, IncomingDropNewest:
+		for _, f := range c.assemble(frame, buf.Bytes()) {
+			c.enqueue(f)
+		}
+	default:
+		c.enqueue(frame)
+	}
+}
+
+// assemble returns the packets complete once frame, holding b, arrived,
+// telling the whole EVENT packets apart. Like queueMessage, it runs on
+// readLoop only.
+func (c *clientConn) assemble(frame *incomingFrame, b []byte) []*incomingFrame {
+	var ret []*incomingFrame
+	if a := c.assembling; a != nil {
+		if frame.typ == MessageBinary {
+			a.attachments = append(a.attachments, frame)
+			if len(a.attachments) < a.want {
+				return nil
+			}
+			c.assembling = nil
+			return append(ret, a)
+		}
+		// fewer attachments than announced, left to the decoder
+		c.assembling = nil
+		ret = append(ret, a)
+	}
+	switch {
+	case c.options.EngineOnly:
+		// messages of the application, with no socket.io packet
+		frame.event = true
+	case c.options.Parser != nil:
+		if p, _, err := c.options.Parser.Decode(b); err == nil {
+			frame.event = p.Type == _EVENT || p.Type == _BINARY_EVENT
+		}
+	case frame.typ == MessageText:
+		p, err := packet.Decode(b)
+		if err != nil {
+			break
+		}
+		frame.event = p.Type == packet.Event || p.Type == packet.BinaryEvent
+		if p.Type.Binary() && p.Attachments > 0 {
+			frame.want = p.Attachments
+			c.assembling = frame
+			return ret
+		}
+	}
+	return append(ret, frame)
+}
+
+// enqueue puts frame in the incoming buffer, applying
+// Options.IncomingPolicy when it is full.
+func (c *clientConn) enqueue(frame *incomingFrame) {
+	select {
+	case c.readerChan <- frame:
+		return
+	default:
+	}
+	switch c.options.IncomingPolicy {
+	case IncomingDropOldest:
+		if !c.dropOldestEvent() && frame.event {
+			// no event buffered before it
+			c.drop(frame)
+			return
+		}
+	case IncomingDropNewest:
+		if frame.event {
+			c.drop(frame)
+			return
+		}
+	case IncomingClose:
+		c.onIncomingOverflow()
+		c.log.Errorf("engine.io %s: incoming buffer full, closing", c.id)
+		c.shutdown(false, ErrIncomingOverflow)
+		return
+	}
+	// waiting for room, control packets, acks and attachments never being
+	// dropped
+	select {
+	case c.readerChan <- frame:
+	case <-c.done:
+	}
+}
+
+// dropOldestEvent drops the oldest whole EVENT packet of the incoming
+// buffer, reporting whether there was one.
+func (c *clientConn) dropOldestEvent() bool {
+	var frames []*incomingFrame
+	for len(frames) < cap(c.readerChan) {
+		select {
+		case f := <-c.readerChan:
+			frames = append(frames, f)
+			continue
+		default:
+		}
+		break
+	}
+	dropped := false
+	for _, f := range frames {
+		if f.event && !dropped {
+			c.drop(f)
+			dropped = true
+			continue
+		}
+		// only this goroutine adds to the buffer, which has room for them
+		c.readerChan <- f
+	}
+	return dropped
+}
+
+// drop drops the packet of frame.
+func (c *clientConn) drop(frame *incomingFrame) {
+	c.onIncomingOverflow()
+	frame.Close()
+}
+
+func (c *clientConn) onIncomingOverflow() {
+	if f := c.options.OnIncomingOverflow; f != nil {
+		f(ErrIncomingOverflow)
+	}
+}
@@ -0,0 +1,134 @@
+package socketio_client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// blockedClient connects a client with policy to a server which, once the
+// client emits "start" with an ack callback, has the client block in the
+// handler of "block" then hands the connection to the test. acks receives
+// the ack of "start" and events the other events.
+func blockedClient(t *testing.T, policy IncomingPolicy, overflows chan struct{}) (conn *MemoryConn, release func(), acks chan string, events chan string) {
+	conns := make(chan *MemoryConn, 1)
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		if !bytes.HasPrefix(f.Data, []byte(`420["start"`)) {
+			return false
+		}
+		conn.WriteFrame(MemoryFrame{Data: []byte(`42["block"]`)})
+		conns <- conn
+		return true
+	})
+	opts := memoryOptions()
+	opts.IncomingBuffer = 2
+	opts.IncomingPolicy = policy
+	opts.OnIncomingOverflow = func(err error) {
+		overflows <- struct{}{}
+	}
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	client.On("block", func() {
+		close(started)
+		<-unblock
+	})
+	events = make(chan string, 8)
+	client.On("x", func(n int) {
+		events <- "x"
+	})
+	client.On("bin", func(a *Attachment) {
+		b, _ := ioutil.ReadAll(a.Data)
+		events <- "bin " + string(b)
+	})
+	acks = make(chan string, 1)
+	client.Emit("start", func(s string) {
+		acks <- s
+	})
+	<-started
+	return <-conns, func() { close(unblock) }, acks, events
+}
+
+func TestIncomingDropOldestKeepsAcksAndAttachments(t *testing.T) {
+	overflows := make(chan struct{}, 8)
+	conn, release, acks, events := blockedClient(t, IncomingDropOldest, overflows)
+	for _, f := range []MemoryFrame{
+		{Data: []byte(`430["ok"]`)},
+		{Data: []byte(`42["x",1]`)},
+		{Data: []byte(`42["x",2]`)},
+		{Data: []byte(`451-["bin",{"_placeholder":true,"num":0}]`)},
+		{Binary: true, Data: []byte("\x04data")},
+	} {
+		conn.WriteFrame(f)
+	}
+	// both x events dropped for the frames after them
+	for i := 0; i < 2; i++ {
+		select {
+		case <-overflows:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no overflow")
+		}
+	}
+	release()
+
+	select {
+	case s := <-acks:
+		if s != "ok" {
+			t.Fatalf("ack %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ack dropped")
+	}
+	select {
+	case e := <-events:
+		if e != "bin data" {
+			t.Fatalf("event %q, want the binary event", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("binary event dropped")
+	}
+}
+
+func TestIncomingDropNewestKeepsAcks(t *testing.T) {
+	overflows := make(chan struct{}, 8)
+	conn, release, acks, events := blockedClient(t, IncomingDropNewest, overflows)
+	for _, f := range []MemoryFrame{
+		{Data: []byte(`42["x",1]`)},
+		{Data: []byte(`42["x",2]`)},
+		{Data: []byte(`42["x",3]`)},
+		{Data: []byte(`430["ok"]`)},
+	} {
+		conn.WriteFrame(f)
+	}
+	select {
+	case <-overflows:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no overflow")
+	}
+	release()
+
+	select {
+	case s := <-acks:
+		if s != "ok" {
+			t.Fatalf("ack %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ack dropped")
+	}
+	for i := 0; i < 2; i++ {
+		if e := <-events; e != "x" {
+			t.Fatalf("event %q", e)
+		}
+	}
+	select {
+	case <-overflows:
+		t.Fatal("more than the third x dropped")
+	default:
+	}
+}
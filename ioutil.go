@@ -1,32 +1,11 @@
 package socketio_client
 
 import (
-	"github.com/zhouhui8915/engine.io-go/parser"
+	"context"
 	"io"
 	"sync"
 )
 
-type connReader struct {
-	*parser.PacketDecoder
-	closeChan chan struct{}
-}
-
-func newConnReader(d *parser.PacketDecoder, closeChan chan struct{}) *connReader {
-	return &connReader{
-		PacketDecoder: d,
-		closeChan:     closeChan,
-	}
-}
-
-func (r *connReader) Close() error {
-	if r.closeChan == nil {
-		return nil
-	}
-	r.closeChan <- struct{}{}
-	r.closeChan = nil
-	return nil
-}
-
 type connWriter struct {
 	io.WriteCloser
 	locker *sync.Mutex
@@ -40,43 +19,44 @@ func newConnWriter(w io.WriteCloser, locker *sync.Mutex) *connWriter {
 }
 
 func (w *connWriter) Close() error {
-	defer func() {
-		if w.locker != nil {
-			w.locker.Unlock()
-			w.locker = nil
+	if wc, ok := w.WriteCloser.(waitCloser); ok {
+		wait, err := wc.closeWait()
+		w.unlock()
+		if err != nil {
+			return err
 		}
-	}()
+		return wait()
+	}
+	defer w.unlock()
 	return w.WriteCloser.Close()
 }
 
+func (w *connWriter) unlock() {
+	if w.locker != nil {
+		w.locker.Unlock()
+		w.locker = nil
+	}
+}
 
-// add with github.com/googollee/go-socket.io/ioutil.go
-
-type writerHelper struct {
-	writer io.Writer
-	err    error
+// waitCloser is implemented by the writers of transports sending packets
+// some time after they are closed, such as coalesced polling POSTs.
+// closeWait hands the packet over and returns how to wait until it is sent,
+// which connWriter calls after releasing the writer lock so that other
+// writers can join the same request.
+type waitCloser interface {
+	closeWait() (wait func() error, err error)
 }
 
-func newWriterHelper(w io.Writer) *writerHelper {
-	return &writerHelper{
-		writer: w,
-	}
+func noWait() error {
+	return nil
 }
 
-func (h *writerHelper) Write(p []byte) {
-	if h.err != nil {
-		return
-	}
-	for len(p) > 0 {
-		n, err := h.writer.Write(p)
-		if err != nil {
-			h.err = err
-			return
-		}
-		p = p[n:]
-	}
+// ctxWriter opens the writers of conn until ctx is done.
+type ctxWriter struct {
+	conn *clientConn
+	ctx  context.Context
 }
 
-func (h *writerHelper) Error() error {
-	return h.err
+func (w *ctxWriter) NextWriter(t MessageType) (io.WriteCloser, error) {
+	return w.conn.nextWriter(w.ctx, t)
 }
@@ -0,0 +1,32 @@
+package socketio_client
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// setGoroutineLabels labels the calling goroutine with role and the given
+// key/value pairs when Options.GoroutineLabels is set, so profiles and
+// goroutine dumps can be attributed to a connection.
+func setGoroutineLabels(opts *Options, role string, kv ...string) {
+	if !opts.GoroutineLabels {
+		return
+	}
+	labels := append([]string{"socketio.role", role}, kv...)
+	for k, v := range opts.Labels {
+		labels = append(labels, k, v)
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(labels...)))
+}
+
+// labeled returns f labeling its goroutine first, as setGoroutineLabels,
+// for the funcs of go statements and time.AfterFunc.
+func labeled(opts *Options, f func(), role string, kv ...string) func() {
+	if !opts.GoroutineLabels {
+		return f
+	}
+	return func() {
+		setGoroutineLabels(opts, role, kv...)
+		f()
+	}
+}
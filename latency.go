@@ -0,0 +1,84 @@
+package socketio_client
+
+import (
+	"sync"
+	"time"
+)
+
+// Latency is the round-trip time of the engine.io heartbeat.
+type Latency struct {
+	Last    time.Duration //time between the last ping and its pong
+	Average time.Duration //average of the recent round trips
+}
+
+const latencySamples = 8
+
+// latencyWindow keeps the last round trips of a connection.
+type latencyWindow struct {
+	lock     sync.Mutex
+	samples  [latencySamples]time.Duration
+	next     int
+	count    int
+	lastPong time.Time
+}
+
+func (w *latencyWindow) add(rtt time.Duration) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.lastPong = time.Now()
+	w.samples[w.next] = rtt
+	w.next = (w.next + 1) % latencySamples
+	if w.count < latencySamples {
+		w.count++
+	}
+}
+
+func (w *latencyWindow) get() Latency {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.count == 0 {
+		return Latency{}
+	}
+	var sum time.Duration
+	for i := 0; i < w.count; i++ {
+		sum += w.samples[i]
+	}
+	last := (w.next + latencySamples - 1) % latencySamples
+	return Latency{
+		Last:    w.samples[last],
+		Average: sum / time.Duration(w.count),
+	}
+}
+
+func (w *latencyWindow) pong() time.Time {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.lastPong
+}
+
+// Latency returns the heartbeat round-trip time of the current connection,
+// zero until the first pong arrived.
+func (client *Client) Latency() Latency {
+	conn, _ := client.manager.connection()
+	return conn.latency.get()
+}
+
+// PingInterval returns the heartbeat interval advertised by the server.
+func (client *Client) PingInterval() time.Duration {
+	conn, _ := client.manager.connection()
+	return conn.pingInterval
+}
+
+// PingTimeout returns how long the server waits for a heartbeat before
+// dropping the connection, and how long the client waits for a pong.
+func (client *Client) PingTimeout() time.Duration {
+	conn, _ := client.manager.connection()
+	return conn.pingTimeout
+}
+
+// LastPong returns when the current connection last answered a ping, the
+// zero time until it did.
+func (client *Client) LastPong() time.Time {
+	conn, _ := client.manager.connection()
+	return conn.latency.pong()
+}
@@ -0,0 +1,79 @@
+package socketio_client
+
+import "context"
+
+// DefaultLimiter applies to clients whose Options.Limiter is nil. It is nil,
+// meaning unlimited, unless set by the application.
+var DefaultLimiter *Limiter
+
+// Limiter caps the connections of the clients sharing it: how many may be
+// handshaking at once and how many may be open in total. Connects and
+// reconnects beyond either cap wait for a free slot, so mass reconnects
+// after a network blip are spread out.
+type Limiter struct {
+	handshakes chan struct{}
+	conns      chan struct{}
+}
+
+// NewLimiter returns a limiter allowing maxHandshakes concurrent handshakes
+// and maxConns open connections. Zero means no limit.
+func NewLimiter(maxHandshakes, maxConns int) *Limiter {
+	l := &Limiter{}
+	if maxHandshakes > 0 {
+		l.handshakes = make(chan struct{}, maxHandshakes)
+	}
+	if maxConns > 0 {
+		l.conns = make(chan struct{}, maxConns)
+	}
+	return l
+}
+
+// acquireConn waits for a free connection slot, giving up once ctx is
+// done.
+func (l *Limiter) acquireConn(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return acquire(ctx, l.conns)
+}
+
+func (l *Limiter) releaseConn() {
+	if l != nil && l.conns != nil {
+		<-l.conns
+	}
+}
+
+// acquireHandshake waits for a free handshake slot, giving up once ctx is
+// done.
+func (l *Limiter) acquireHandshake(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return acquire(ctx, l.handshakes)
+}
+
+func (l *Limiter) releaseHandshake() {
+	if l != nil && l.handshakes != nil {
+		<-l.handshakes
+	}
+}
+
+// acquire takes a slot of sem, nil meaning unlimited.
+func acquire(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func optionsLimiter(opts *Options) *Limiter {
+	if opts.Limiter != nil {
+		return opts.Limiter
+	}
+	return DefaultLimiter
+}
@@ -0,0 +1,43 @@
+package socketio_client
+
+import "sort"
+
+// ListenerCount returns how many handlers event has, registered with On and
+// OnPriority. Pattern handlers are not counted, see HasListeners.
+func (client *Client) ListenerCount(event string) int {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	n := len(client.priorities[event])
+	if _, ok := client.events[event]; ok {
+		n++
+	}
+	return n
+}
+
+// HasListeners reports whether event has a handler, including one
+// registered with OnPattern or OnMatch.
+func (client *Client) HasListeners(event string) bool {
+	if client.ListenerCount(event) > 0 {
+		return true
+	}
+	_, ok := client.handler(event)
+	return ok
+}
+
+// EventNames returns the sorted names of the events with a handler
+// registered with On or OnPriority.
+func (client *Client) EventNames() []string {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	ret := make([]string, 0, len(client.events)+len(client.priorities))
+	for event := range client.events {
+		ret = append(ret, event)
+	}
+	for event, handlers := range client.priorities {
+		if _, ok := client.events[event]; !ok && len(handlers) > 0 {
+			ret = append(ret, event)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
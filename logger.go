@@ -0,0 +1,66 @@
+package socketio_client
+
+import "log"
+
+// Logger receives the internal log messages of the client. *logrus.Logger,
+// *zap.SugaredLogger and similar loggers implement it.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// LogLevel limits the messages passed to the Logger.
+type LogLevel int
+
+const (
+	LogDefault LogLevel = iota // everything goes to Options.Logger, nothing without one
+	LogError
+	LogInfo
+	LogDebug // also every state change, upgrade step and ping/pong
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// stdLogger writes to the standard logger, used when a LogLevel is set
+// without a Logger.
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) { log.Printf("DEBUG "+format, args...) }
+func (stdLogger) Infof(format string, args ...interface{})  { log.Printf("INFO "+format, args...) }
+func (stdLogger) Errorf(format string, args ...interface{}) { log.Printf("ERROR "+format, args...) }
+
+type leveledLogger struct {
+	Logger
+	level LogLevel
+}
+
+func (l leveledLogger) Debugf(format string, args ...interface{}) {
+	if l.level >= LogDebug {
+		l.Logger.Debugf(format, args...)
+	}
+}
+
+func (l leveledLogger) Infof(format string, args ...interface{}) {
+	if l.level >= LogInfo {
+		l.Logger.Infof(format, args...)
+	}
+}
+
+func optionsLogger(opts *Options) Logger {
+	logger := opts.Logger
+	if opts.LogLevel == LogDefault {
+		if logger == nil {
+			return nopLogger{}
+		}
+		return logger
+	}
+	if logger == nil {
+		logger = stdLogger{}
+	}
+	return leveledLogger{Logger: logger, level: opts.LogLevel}
+}
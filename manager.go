@@ -0,0 +1,714 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	managersLock sync.Mutex
+	managers     = make(map[string]*manager)
+)
+
+// manager owns one engine.io connection and multiplexes the namespace
+// clients opened against the same url over it. The connection is torn down
+// once the last client is released and the linger period has passed.
+type manager struct {
+	seq uint64 // orders events buffered across namespaces, accessed atomically; starts at the creation time so that events persisted by an earlier process sort first
+
+	key        string
+	opts       *Options
+	url        *url.URL
+	endpoints  *endpoints
+	jar        http.CookieJar
+	log        Logger
+	dispatcher *dispatcher
+
+	lock         sync.Mutex
+	conn         *clientConn
+	response     *HandshakeResponse
+	clients      map[string]*Client
+	refs         int
+	linger       *time.Timer
+	closed       bool
+	reconnecting bool
+	reconnects   int
+	flushing     bool
+	awaiting     map[string]bool //namespaces whose CONNECT sent on reconnecting is unanswered, holding back the flush
+	err          error           //why the manager closed, see Client.Err
+	done         chan struct{}   //closed once err is set
+
+	ctx    context.Context //canceled once the manager is closed, or with Options.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup //run and watch
+}
+
+// namespaceOptions are the fields of Options read from each client rather
+// than from the connection, which clients sharing it may set differently.
+var namespaceOptions = map[string]bool{
+	"Namespace":         true,
+	"TraceHandler":      true,
+	"TraceEmit":         true,
+	"OnHandlerPanic":    true,
+	"OnDecodeError":     true,
+	"OnUnhandledEvent":  true,
+	"Encrypt":           true,
+	"Decrypt":           true,
+	"StrictEvents":      true,
+	"IncomingRateLimit": true,
+	"Chunking":          true,
+	"BufferEmits":       true,
+	"Outbox":            true,
+	"Retry":             true,
+	"AckTimeout":        true,
+	"EmitRateLimit":     true,
+	"Sampler":           true,
+}
+
+// managerKey returns the key of the manager connecting to u with opts.
+// Clients share a connection only when they agree on the other fields of
+// Options: values are compared by content, pointers by identity. Funcs
+// cannot be compared, so a client setting one, such as TokenSource, only
+// shares with the clients given the same *Options.
+func managerKey(u *url.URL, opts *Options) string {
+	var b strings.Builder
+	b.WriteString(u.String())
+	v := reflect.ValueOf(opts).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if namespaceOptions[name] {
+			continue
+		}
+		b.WriteString("\x00" + name + "=")
+		writeKey(&b, v.Field(i), opts)
+	}
+	return b.String()
+}
+
+func writeKey(b *strings.Builder, v reflect.Value, opts *Options) {
+	switch v.Kind() {
+	case reflect.Func:
+		if v.IsNil() {
+			b.WriteString("nil")
+		} else {
+			fmt.Fprintf(b, "func@%p", opts)
+		}
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		fmt.Fprintf(b, "%#x", v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+		} else {
+			writeKey(b, v.Elem(), opts)
+		}
+	default:
+		fmt.Fprintf(b, "%#v", v.Interface())
+	}
+}
+
+func acquireManager(urls []*url.URL, opts *Options, client *Client, deadline time.Time) (*manager, error) {
+	u := urls[0]
+	key := managerKey(u, opts)
+
+	managersLock.Lock()
+	m, ok := managers[key]
+	managersLock.Unlock()
+	if ok && m.attach(client) {
+		return m, nil
+	}
+
+	jar := opts.Jar
+	if jar == nil {
+		jar, _ = cookiejar.New(nil)
+	}
+	eps := newEndpoints(urls, opts.FallbackPolicy)
+	log := optionsLogger(opts)
+	ctx, cancel := context.WithCancel(optionsContext(opts))
+	conn, err := eps.dial(ctx, opts, jar, log, deadline)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	m = &manager{
+		seq:        uint64(time.Now().UnixNano()),
+		key:        key,
+		opts:       opts,
+		url:        redactURL(u),
+		endpoints:  eps,
+		jar:        jar,
+		log:        log,
+		dispatcher: newDispatcher(opts),
+		conn:       conn,
+		response:   conn.response,
+		clients:    make(map[string]*Client),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	m.attach(client)
+
+	managersLock.Lock()
+	if _, exists := managers[key]; !exists {
+		managers[key] = m
+	}
+	managersLock.Unlock()
+
+	m.wg.Add(2)
+	go m.run()
+	go m.watch()
+
+	return m, nil
+}
+
+// watch closes the manager once its context is canceled.
+func (m *manager) watch() {
+	defer m.wg.Done()
+	setGoroutineLabels(m.opts, "watch")
+	<-m.ctx.Done()
+	m.lock.Lock()
+	if !m.closeLocked(&classError{class: ErrClosed, err: m.ctx.Err()}) {
+		m.lock.Unlock()
+		return
+	}
+	conn := m.conn
+	m.lock.Unlock()
+	m.unregister()
+	m.log.Infof("socket.io %s: %v, closing", m.url, m.ctx.Err())
+	conn.Close()
+}
+
+// closeErr returns why the manager closed, nil while it is open.
+func (m *manager) closeErr() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.err
+}
+
+// wait blocks until the goroutines of the manager have stopped.
+func (m *manager) wait() {
+	m.wg.Wait()
+}
+
+func (m *manager) attach(client *Client) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return false
+	}
+	if _, exists := m.clients[client.namespace]; exists {
+		return false
+	}
+	if m.linger != nil {
+		m.linger.Stop()
+		m.linger = nil
+	}
+	m.clients[client.namespace] = client
+	m.refs++
+	client.manager = m
+	return true
+}
+
+// connection returns the current engine connection and whether the manager
+// is waiting to reconnect it.
+func (m *manager) connection() (*clientConn, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.conn, m.reconnecting
+}
+
+// writeState is like connection and also reports whether buffered events are
+// still being flushed, during which new events must be queued behind them.
+func (m *manager) writeState() (*clientConn, bool, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.conn, m.reconnecting, m.flushing
+}
+
+func (m *manager) nextSeq() uint64 {
+	return atomic.AddUint64(&m.seq, 1)
+}
+
+// connected reports whether client is attached to a live connection.
+func (m *manager) connected(client *Client) bool {
+	m.lock.Lock()
+	conn, up := m.conn, !m.closed && !m.reconnecting && m.clients[client.namespace] == client
+	m.lock.Unlock()
+	if !up {
+		return false
+	}
+	s := conn.getState()
+	return s == stateNormal || s == stateUpgrading
+}
+
+func (m *manager) reconnectCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.reconnects
+}
+
+func (m *manager) lastResponse() *HandshakeResponse {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.response
+}
+
+func (m *manager) snapshot() []*Client {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	clients := make([]*Client, 0, len(m.clients))
+	for _, c := range m.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func (m *manager) client(namespace string) *Client {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.clients[namespace]
+}
+
+// release detaches client and drops its reference. It reports whether the
+// client was still attached.
+func (m *manager) release(client *Client) (bool, error) {
+	m.lock.Lock()
+	if m.clients[client.namespace] != client {
+		m.lock.Unlock()
+		return false, nil
+	}
+	delete(m.clients, client.namespace)
+	m.refs--
+	if m.refs > 0 || m.closed {
+		m.lock.Unlock()
+		return true, nil
+	}
+	if m.opts.Linger > 0 {
+		m.linger = time.AfterFunc(m.opts.Linger, labeled(m.opts, m.expire, "linger"))
+		m.lock.Unlock()
+		return true, nil
+	}
+	m.closeLocked(nil)
+	conn := m.conn
+	m.lock.Unlock()
+	m.unregister()
+	return true, conn.Close()
+}
+
+func (m *manager) expire() {
+	m.lock.Lock()
+	if m.refs > 0 || !m.closeLocked(nil) {
+		m.lock.Unlock()
+		return
+	}
+	conn := m.conn
+	m.lock.Unlock()
+	m.unregister()
+	conn.Close()
+}
+
+// closeLocked stops new clients from attaching, err telling why, nil when
+// on purpose. It reports whether the manager was still open. m.lock must be
+// held.
+func (m *manager) closeLocked(err error) bool {
+	if m.closed {
+		return false
+	}
+	m.closed = true
+	m.err = ErrClosed
+	if err != nil {
+		m.err = err
+	}
+	close(m.done)
+	m.cancel()
+	if m.linger != nil {
+		m.linger.Stop()
+		m.linger = nil
+	}
+	return true
+}
+
+func (m *manager) unregister() {
+	managersLock.Lock()
+	defer managersLock.Unlock()
+	if managers[m.key] == m {
+		delete(managers, m.key)
+	}
+}
+
+func (m *manager) run() {
+	defer m.wg.Done()
+	defer m.dispatcher.stop()
+	for {
+		conn, _ := m.connection()
+		setGoroutineLabels(m.opts, "dispatcher", "socketio.sid", conn.Id())
+		err := m.readLoop()
+
+		m.lock.Lock()
+		retry := m.opts.Reconnection && !m.closed
+		if retry {
+			m.reconnecting = true
+		} else {
+			m.closeLocked(err)
+		}
+		conn = m.conn
+		m.lock.Unlock()
+
+		conn.Close()
+		conn.wait()
+		clients := m.snapshot()
+		for _, c := range clients {
+			c.onDisconnect()
+		}
+		if !retry {
+			m.unregister()
+			for _, c := range clients {
+				c.failAcks(m.closeErr())
+			}
+			return
+		}
+		m.log.Infof("socket.io %s: connection lost: %v, reconnecting", m.url, err)
+		if err == nil {
+			err = ErrClosed
+		}
+		for _, c := range clients {
+			c.failLostAcks(err)
+		}
+
+		if !m.reconnect(conn) {
+			m.lock.Lock()
+			m.closeLocked(ErrReconnectFailed)
+			m.reconnecting = false
+			m.lock.Unlock()
+			m.unregister()
+			m.log.Errorf("socket.io %s: giving up reconnecting", m.url)
+			for _, c := range m.snapshot() {
+				c.failAcks(m.closeErr())
+				c.emitLocal("reconnect_failed")
+			}
+			return
+		}
+	}
+}
+
+// reconnect opens a new connection in place of lost, taking over its
+// session when Options.ResumeSession allows it.
+func (m *manager) reconnect(lost *clientConn) bool {
+	exhausted := 0
+	var retryAfter time.Duration
+	for attempt := 1; m.opts.ReconnectionAttempts <= 0 || attempt <= m.opts.ReconnectionAttempts; attempt++ {
+		delay := m.backoff(attempt)
+		switch {
+		case retryAfter > 0:
+			delay = retryAfter
+		case exhausted > 0:
+			delay = exhaustedBackoff(m.opts, exhausted)
+		}
+		retryAfter = 0
+		select {
+		case <-time.After(delay):
+		case <-m.ctx.Done():
+			return false
+		}
+		for _, c := range m.snapshot() {
+			c.emitLocal("reconnect_attempt", attempt)
+		}
+
+		var conn *clientConn
+		opts, eps, err := m.attemptOptions(attempt)
+		if err == nil && lost != nil && opts.ResumeSession && eps == m.endpoints && lost.resumable(time.Now()) {
+			if conn, err = resumeClientConn(m.ctx, opts, lost); err != nil {
+				// once refused, the session is not tried again
+				m.log.Infof("socket.io %s: %v, handshaking again", m.url, err)
+				conn, lost, err = nil, nil, nil
+			}
+		}
+		if err == nil && conn == nil {
+			conn, err = eps.dial(m.ctx, opts, m.jar, m.log, time.Time{})
+		}
+		var handshakeErr *HandshakeError
+		if errors.As(err, &handshakeErr) {
+			m.lock.Lock()
+			m.response = handshakeErr.Response
+			m.lock.Unlock()
+			retryAfter = retryAfterDelay(handshakeErr.Response, time.Now())
+		}
+		if err != nil {
+			var exhaustedErr *ResourceExhaustedError
+			if errors.As(err, &exhaustedErr) {
+				exhausted++
+			} else {
+				exhausted = 0
+			}
+			m.log.Infof("socket.io %s: reconnect attempt %d failed: %v", m.url, attempt, err)
+			for _, c := range m.snapshot() {
+				c.emitLocal("reconnect_error", err)
+			}
+			continue
+		}
+
+		m.lock.Lock()
+		if m.closed {
+			m.lock.Unlock()
+			conn.Close()
+			return false
+		}
+		m.conn = conn
+		m.response = conn.response
+		m.reconnecting = false
+		m.reconnects++
+		m.flushing = true
+		m.lock.Unlock()
+
+		clients := m.snapshot()
+		awaiting := make(map[string]bool)
+		if conn.resumed {
+			// the server still holds the namespaces of the session
+			m.log.Infof("socket.io %s: resumed session %s after %d attempts", m.url, conn.Id(), attempt)
+		} else {
+			m.log.Infof("socket.io %s: reconnected after %d attempts", m.url, attempt)
+			for _, c := range clients {
+				if c.namespace != "" {
+					awaiting[c.namespace] = true
+				}
+			}
+		}
+		m.lock.Lock()
+		m.awaiting = awaiting
+		m.lock.Unlock()
+		if len(awaiting) == 0 {
+			m.flushOutboxes()
+		}
+		for _, c := range clients {
+			if awaiting[c.namespace] {
+				// the outboxes are flushed once all are answered
+				c.sendConnect()
+			}
+		}
+		for _, c := range clients {
+			c.emitLocal("reconnect", attempt)
+		}
+		return true
+	}
+	return false
+}
+
+// answered notes the answer of the server to the CONNECT of the namespace
+// nsp sent on reconnecting, flushing the outboxes once all the namespaces
+// have theirs.
+func (m *manager) answered(nsp string) {
+	m.lock.Lock()
+	if !m.awaiting[nsp] {
+		m.lock.Unlock()
+		return
+	}
+	delete(m.awaiting, nsp)
+	flush := len(m.awaiting) == 0
+	m.lock.Unlock()
+	if flush {
+		m.flushOutboxes()
+	}
+}
+
+// flushOutboxes sends the events buffered while reconnecting in the order
+// they were emitted, across all namespaces, then lets new events through.
+// Namespaces without an outbox queue the events emitted meanwhile, which
+// are sent in order too. Whatever could not be sent stays queued for the
+// next connection.
+func (m *manager) flushOutboxes() error {
+	conn, _ := m.connection()
+	for {
+		var (
+			next *Client
+			p    Packet
+		)
+		for _, c := range m.snapshot() {
+			c.bufferLock.Lock()
+			q, ok, err := c.queue().Peek()
+			c.bufferLock.Unlock()
+			if err != nil {
+				m.endFlush()
+				return err
+			}
+			if ok && (next == nil || q.seq < p.seq) {
+				next, p = c, q
+			}
+		}
+		if next == nil {
+			if m.tryEndFlush() {
+				return nil
+			}
+			continue
+		}
+
+		next.bufferLock.Lock()
+		err := next.encode(conn, p)
+		if err == nil {
+			err = next.queue().Pop()
+		}
+		next.bufferLock.Unlock()
+		if err != nil {
+			m.endFlush()
+			return err
+		}
+	}
+}
+
+// tryEndFlush stops queueing new events unless some were queued since the
+// outboxes were last found empty.
+func (m *manager) tryEndFlush() bool {
+	clients := m.snapshot()
+	for _, c := range clients {
+		c.bufferLock.Lock()
+		defer c.bufferLock.Unlock()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.clients) != len(clients) {
+		return false
+	}
+	for _, c := range clients {
+		if m.clients[c.namespace] != c {
+			return false
+		}
+		if _, ok, _ := c.queue().Peek(); ok {
+			return false
+		}
+	}
+	m.flushing = false
+	return true
+}
+
+func (m *manager) endFlush() {
+	m.lock.Lock()
+	m.flushing = false
+	m.lock.Unlock()
+}
+
+// backoff returns the randomized exponential delay before the given
+// reconnect attempt.
+func (m *manager) backoff(attempt int) time.Duration {
+	delay := m.opts.ReconnectionDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	max := m.opts.ReconnectionDelayMax
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	delay += time.Duration(rand.Int63n(int64(delay))) - delay/2
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// retryAfterDelay returns the delay asked for by the Retry-After header of
+// a 503 or 429 response, or 0.
+func retryAfterDelay(resp *HandshakeResponse, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// exhaustedBackoff returns the delay before retrying after the given number
+// of consecutive dials failed for lack of file descriptors. It backs off
+// much slower than the reconnect delay to let descriptors get released.
+func exhaustedBackoff(opts *Options, exhausted int) time.Duration {
+	delay := opts.ResourceExhaustedDelay
+	if delay <= 0 {
+		delay = 10 * time.Second
+	}
+	max := opts.ResourceExhaustedDelayMax
+	if max <= 0 {
+		max = 2 * time.Minute
+	}
+	for i := 1; i < exhausted && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func (m *manager) readLoop() error {
+	conn, _ := m.connection()
+	if m.opts.EngineOnly {
+		return m.readEngine(conn)
+	}
+	for {
+		decoder := newDecoder(conn)
+		decoder.strict = m.opts.StrictProtocol
+		decoder.tracer = m.opts.Tracer
+		decoder.parser = m.opts.Parser
+		decoder.useNumber = m.opts.JSONUseNumber
+		decoder.disallowUnknownFields = m.opts.JSONDisallowUnknownFields
+		var p Packet
+		if err := decoder.Decode(&p); err != nil {
+			var violation *ProtocolViolation
+			if errors.As(err, &violation) && m.opts.OnProtocolViolation != nil {
+				m.opts.OnProtocolViolation(violation)
+			}
+			return err
+		}
+		client := m.client(p.NSP)
+		if client == nil {
+			decoder.Close()
+			continue
+		}
+		if m.dispatcher.mode != DispatchSerial && (p.Type == _EVENT || p.Type == _BINARY_EVENT || p.Type == _ACK || p.Type == _BINARY_ACK) {
+			p := p
+			key := ""
+			if p.Type == _EVENT || p.Type == _BINARY_EVENT {
+				key = p.NSP + "\x00" + decoder.Message()
+			}
+			m.dispatcher.run(key, func() {
+				if err := client.handlePacket(decoder, &p); err != nil {
+					m.log.Errorf("socket.io %s: handling %s: %v", m.url, decoder.Message(), err)
+				}
+			})
+			continue
+		}
+		var err error
+		m.dispatcher.serially(func() { err = client.handlePacket(decoder, &p) })
+		if err != nil {
+			return err
+		}
+		if p.Type == _DISCONNECT {
+			m.release(client)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package socketio_client
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	unavailable := func(value string) *HandshakeResponse {
+		return &HandshakeResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": {value}},
+		}
+	}
+	tests := []struct {
+		resp *HandshakeResponse
+		want time.Duration
+	}{
+		{nil, 0},
+		{&HandshakeResponse{StatusCode: http.StatusForbidden}, 0},
+		{unavailable("3"), 3 * time.Second},
+		{unavailable("-1"), 0},
+		{unavailable(now.Add(time.Minute).Format(http.TimeFormat)), time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryAfterDelay(tt.resp, now); got != tt.want {
+			t.Errorf("retryAfterDelay(%+v) = %v, want %v", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestManagerSharedByOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   func(o *Options)
+		other  func(o *Options)
+		shared bool
+	}{
+		{"same", func(o *Options) {}, func(o *Options) {}, true},
+		{"namespace settings", func(o *Options) {}, func(o *Options) {
+			o.AckTimeout = time.Second
+			o.TraceEmit = func(EmitInfo) func(error) { return nil }
+		}, true},
+		{"same tls config", func(o *Options) { o.TLSConfig = &tls.Config{} }, func(o *Options) {}, true},
+		{"header", func(o *Options) {}, func(o *Options) { o.Header = map[string][]string{"X-User": {"2"}} }, false},
+		{"tls config", func(o *Options) { o.TLSConfig = &tls.Config{} }, func(o *Options) { o.TLSConfig = &tls.Config{} }, false},
+		{"token source", func(o *Options) {
+			o.TokenSource = func() (string, error) { return "1", nil }
+		}, func(o *Options) {}, false},
+	}
+	for _, tt := range tests {
+		uri := newMemoryServer(t, nil)
+		base := memoryOptions()
+		base.Namespace = "/a"
+		tt.base(base)
+		first, err := NewClient(uri, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := *base
+		other.Namespace = "/b"
+		tt.other(&other)
+		second, err := NewClient(uri, &other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shared := first.manager == second.manager; shared != tt.shared {
+			t.Errorf("%s: shared %v, want %v", tt.name, shared, tt.shared)
+		}
+		first.Close()
+		second.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package socketio_client
+
+// Middleware sees a packet before it moves on. It must call next to pass
+// the packet along; a packet whose middleware never calls next is dropped.
+type Middleware func(pkt *Packet, next func())
+
+// runMiddleware passes pkt through chain and then to last. The error of last
+// is returned when the chain reaches it before runMiddleware returns.
+func runMiddleware(chain []Middleware, pkt *Packet, last func(pkt *Packet) error) error {
+	errChan := make(chan error, 1)
+	runChain(chain, pkt, func() {
+		err := last(pkt)
+		select {
+		case errChan <- err:
+		default:
+		}
+	})
+	select {
+	case err := <-errChan:
+		return err
+	default:
+		return nil
+	}
+}
+
+func runChain(chain []Middleware, pkt *Packet, last func()) {
+	if len(chain) == 0 {
+		last()
+		return
+	}
+	chain[0](pkt, func() {
+		runChain(chain[1:], pkt, last)
+	})
+}
+
+// UseOutgoing appends f to the chain run on every packet the client sends,
+// so it can add metadata, sign, delay or drop it. Errors from the transport
+// are only reported to the caller when next is called before f returns.
+func (client *Client) UseOutgoing(f Middleware) {
+	client.middlewareLock.Lock()
+	defer client.middlewareLock.Unlock()
+	client.outgoing = append(client.outgoing[:len(client.outgoing):len(client.outgoing)], f)
+}
+
+// UseIncoming appends f to the chain run on every packet received for the
+// namespace before it is dispatched to handlers. For events and acks
+// pkt.Data holds the raw JSON arguments as []json.RawMessage, the event
+// name first, so f can decrypt, validate or filter them.
+func (client *Client) UseIncoming(f Middleware) {
+	client.middlewareLock.Lock()
+	defer client.middlewareLock.Unlock()
+	client.incoming = append(client.incoming[:len(client.incoming):len(client.incoming)], f)
+}
+
+func (client *Client) sendPacket(p Packet) error {
+	client.middlewareLock.RLock()
+	chain := client.outgoing
+	client.middlewareLock.RUnlock()
+
+	if len(chain) == 0 {
+		return client.write(&p)
+	}
+	return runMiddleware(chain, &p, client.write)
+}
@@ -0,0 +1,237 @@
+// Package mockclient fakes a socket.io client, to unit test code written
+// against socketio_client.SocketClient without a server. Emits are recorded
+// and acked with scripted values, and events are fed to the handlers with
+// Receive, their arguments going through JSON as with a real server.
+//
+//	client := mockclient.New("/")
+//	client.Ack("join", "ok")
+//	startChat(client) // calls client.On("message", ...) and client.Emit("join", room, ack)
+//	client.Receive("message", "hello")
+//	if emits := client.Emits(); len(emits) != 1 || emits[0].Event != "join" {
+//		t.Fatal(emits)
+//	}
+package mockclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Emit is an event emitted through the fake.
+type Emit struct {
+	Event string
+	Args  []interface{} //without the ack callback
+	Acked bool          //the ack callback was called with the values given to Ack
+}
+
+// Client is a fake socketio_client.SocketClient. It is safe for concurrent
+// use.
+type Client struct {
+	namespace string
+
+	lock      sync.Mutex
+	handlers  map[string]reflect.Value
+	acks      map[string][]interface{}
+	emits     []Emit
+	connected bool
+	err       error
+	done      chan struct{}
+}
+
+var _ socketio_client.SocketClient = (*Client)(nil)
+
+// New returns a connected fake joined to namespace, "/" for the default
+// one.
+func New(namespace string) *Client {
+	if namespace == "" {
+		namespace = "/"
+	}
+	return &Client{
+		namespace: namespace,
+		handlers:  make(map[string]reflect.Value),
+		acks:      make(map[string][]interface{}),
+		connected: true,
+		done:      make(chan struct{}),
+	}
+}
+
+// On registers f as the handler of event, replacing any other.
+func (c *Client) On(event string, f interface{}) error {
+	fv := reflect.ValueOf(f)
+	if fv.Kind() != reflect.Func {
+		return fmt.Errorf("f is not func")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handlers[event] = fv
+	return nil
+}
+
+// Emit records the event. When its last argument is an ack callback and
+// Ack scripted values for event, the callback is called with them before
+// Emit returns. It fails with socketio_client.ErrClosed once closed.
+func (c *Client) Emit(event string, args ...interface{}) error {
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return c.err
+	}
+	var ack reflect.Value
+	if l := len(args); l > 0 && reflect.ValueOf(args[l-1]).Kind() == reflect.Func {
+		ack, args = reflect.ValueOf(args[l-1]), args[:l-1]
+	}
+	ackArgs, scripted := c.acks[event]
+	emit := Emit{Event: event, Args: args, Acked: ack.IsValid() && scripted}
+	c.emits = append(c.emits, emit)
+	c.lock.Unlock()
+
+	if !emit.Acked {
+		return nil
+	}
+	_, err := call(ack, ackArgs)
+	return err
+}
+
+// EmitTimeout is Emit, the fake acking at once or never.
+func (c *Client) EmitTimeout(timeout time.Duration, event string, args ...interface{}) error {
+	return c.Emit(event, args...)
+}
+
+// Ack scripts the arguments of the ack of the emits of event that have an
+// ack callback.
+func (c *Client) Ack(event string, args ...interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.acks[event] = args
+}
+
+// Emits returns the events emitted so far, in order.
+func (c *Client) Emits() []Emit {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Emit(nil), c.emits...)
+}
+
+// Reset forgets the events emitted so far.
+func (c *Client) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.emits = nil
+}
+
+// Receive calls the handler of event as if the server emitted it with
+// args, which are encoded to JSON and decoded into the arguments of the
+// handler. It returns the values the handler returned, which a real client
+// would send back as the ack, and fails when there is no handler or args
+// don't fit it.
+func (c *Client) Receive(event string, args ...interface{}) ([]interface{}, error) {
+	c.lock.Lock()
+	f, ok := c.handlers[event]
+	c.lock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", socketio_client.ErrUnhandledEvent, event)
+	}
+	return call(f, args)
+}
+
+// SetConnected sets what Connected reports, such as to test how code
+// behaves while the connection is down.
+func (c *Client) SetConnected(connected bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = connected
+}
+
+// Namespace returns the namespace given to New.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// Connected reports whether the fake is connected, true until closed or
+// told otherwise by SetConnected.
+func (c *Client) Connected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connected
+}
+
+// Done returns a channel closed once the fake is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil until the fake is closed, and then why.
+func (c *Client) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+// Close closes the fake with socketio_client.ErrClosed.
+func (c *Client) Close() error {
+	c.CloseWithError(socketio_client.ErrClosed)
+	return nil
+}
+
+// CloseWithError closes the fake with err, such as to test how code
+// behaves when the connection is lost for good.
+func (c *Client) CloseWithError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err, c.connected = err, false
+	close(c.done)
+}
+
+// call calls f with args converted to its parameters through JSON.
+func call(f reflect.Value, args []interface{}) ([]interface{}, error) {
+	ft := f.Type()
+	first := 0
+	in := make([]reflect.Value, 0, ft.NumIn())
+	if ft.NumIn() > 0 && ft.In(0) == contextType {
+		in = append(in, reflect.ValueOf(context.Background()))
+		first = 1
+	}
+	params := ft.NumIn() - first
+	if !ft.IsVariadic() && len(args) > params {
+		args = args[:params]
+	}
+	for i := 0; i < params || i < len(args); i++ {
+		var t reflect.Type
+		switch {
+		case ft.IsVariadic() && i >= params-1:
+			t = ft.In(ft.NumIn() - 1).Elem()
+		default:
+			t = ft.In(first + i)
+		}
+		v := reflect.New(t)
+		if i < len(args) {
+			b, err := json.Marshal(args[i])
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, v.Interface()); err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i, err)
+			}
+		} else if ft.IsVariadic() && i >= params-1 {
+			break
+		}
+		in = append(in, v.Elem())
+	}
+	out := f.Call(in)
+	ret := make([]interface{}, len(out))
+	for i, v := range out {
+		ret[i] = v.Interface()
+	}
+	return ret, nil
+}
@@ -0,0 +1,198 @@
+// Package otelsocketio records OpenTelemetry spans for the emits and event
+// handlers of socket.io clients, and carries their trace across the
+// connection:
+//
+//	opts := &socketio_client.Options{}
+//	otelsocketio.Instrument(opts, tracerProvider)
+//	client, err := socketio_client.NewClient(uri, opts)
+//	client.UseOutgoing(otelsocketio.Inject(nil))
+//	client.UseIncoming(otelsocketio.Extract(nil))
+package otelsocketio
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+const instrumentationName = "github.com/h2570su/go-socket.io-client/otelsocketio"
+
+var (
+	systemKey    = attribute.Key("messaging.system")
+	namespaceKey = attribute.Key("messaging.destination")
+	sizeKey      = attribute.Key("messaging.message_payload_size_bytes")
+	eventKey     = attribute.Key("socketio.event")
+	ackKey       = attribute.Key("socketio.ack")
+	ackRTTKey    = attribute.Key("socketio.ack.rtt_ms")
+)
+
+// Instrument hooks tracing into opts, keeping the TraceEmit and
+// TraceHandler already set. Each emit gets a span ending once the event is
+// sent, or acknowledged when it has an ack callback, a child of the span of
+// the context given to Client.EmitContext. Each event handler invocation
+// gets one too, a child of the trace Extract found in the event, and the
+// handler runs within it. Spans come from tp, or from the global provider
+// when tp is nil. Call it before NewClient.
+func Instrument(opts *socketio_client.Options, tp trace.TracerProvider) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(instrumentationName)
+
+	traceEmit := opts.TraceEmit
+	opts.TraceEmit = func(info socketio_client.EmitInfo) func(err error) {
+		var next func(err error)
+		if traceEmit != nil {
+			next = traceEmit(info)
+		}
+		kind := trace.SpanKindProducer
+		if info.Ack {
+			kind = trace.SpanKindClient
+		}
+		ctx := info.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		start := time.Now()
+		ctx, span := tracer.Start(ctx, "socket.io emit "+info.Event,
+			trace.WithSpanKind(kind),
+			trace.WithTimestamp(start),
+			trace.WithAttributes(
+				systemKey.String("socket.io"),
+				namespaceKey.String(info.Namespace),
+				eventKey.String(info.Event),
+				sizeKey.Int(info.Size),
+				ackKey.Bool(info.Ack),
+			),
+		)
+		info.SetContext(ctx)
+		return func(err error) {
+			if info.Ack && err == nil {
+				span.SetAttributes(ackRTTKey.Float64(float64(time.Since(start)) / float64(time.Millisecond)))
+			}
+			end(span, err)
+			if next != nil {
+				next(err)
+			}
+		}
+	}
+
+	traceHandler := opts.TraceHandler
+	opts.TraceHandler = func(info socketio_client.HandlerInfo) func(err error) {
+		var next func(err error)
+		if traceHandler != nil {
+			next = traceHandler(info)
+		}
+		ctx := info.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, span := tracer.Start(ctx, "socket.io handle "+info.Event,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				systemKey.String("socket.io"),
+				namespaceKey.String(info.Namespace),
+				eventKey.String(info.Event),
+				sizeKey.Int(info.Size),
+			),
+		)
+		// the spans of the handler are children of this one
+		info.SetContext(ctx)
+		return func(err error) {
+			end(span, err)
+			if next != nil {
+				next(err)
+			}
+		}
+	}
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// carrierKey names the object carrying the trace of an event, see Inject.
+const carrierKey = "_otel"
+
+// carrier holds the trace of an event as a JSON object.
+type carrier map[string]string
+
+func (c carrier) Get(key string) string {
+	return c[key]
+}
+
+func (c carrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c carrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Inject returns an outgoing middleware adding the trace of each event
+// emitted as a last argument {"_otel":{...}}, which Extract takes out on the
+// receiving side. With Instrument the trace is the one of the emit span.
+// The trace is encoded by p, W3C trace context when p is nil.
+func Inject(p propagation.TextMapPropagator) socketio_client.Middleware {
+	p = propagator(p)
+	return func(pkt *socketio_client.Packet, next func()) {
+		args, ok := pkt.Data.([]interface{})
+		if ok && isEvent(pkt.Type) {
+			c := carrier{}
+			p.Inject(pkt.Context(), c)
+			if len(c) > 0 {
+				// args may be sent again by a retry
+				pkt.Data = append(args[:len(args):len(args)], map[string]carrier{carrierKey: c})
+			}
+		}
+		next()
+	}
+}
+
+// Extract returns an incoming middleware taking the trace Inject added out
+// of the arguments of each event, so that the handlers run within it, as
+// the spans Instrument starts for them. The trace is decoded by p, W3C
+// trace context when p is nil.
+func Extract(p propagation.TextMapPropagator) socketio_client.Middleware {
+	p = propagator(p)
+	return func(pkt *socketio_client.Packet, next func()) {
+		args, ok := pkt.Data.([]json.RawMessage)
+		if ok && isEvent(pkt.Type) && len(args) > 1 {
+			var last map[string]carrier
+			if json.Unmarshal(args[len(args)-1], &last) == nil && len(last) == 1 && last[carrierKey] != nil {
+				pkt.SetContext(p.Extract(pkt.Context(), last[carrierKey]))
+				pkt.Data = args[:len(args)-1]
+			}
+		}
+		next()
+	}
+}
+
+func propagator(p propagation.TextMapPropagator) propagation.TextMapPropagator {
+	if p == nil {
+		return propagation.TraceContext{}
+	}
+	return p
+}
+
+func isEvent(t socketio_client.PacketType) bool {
+	return t == socketio_client.PacketEvent || t == socketio_client.PacketBinaryEvent
+}
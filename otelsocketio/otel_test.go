@@ -0,0 +1,200 @@
+package otelsocketio
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+	"github.com/h2570su/go-socket.io-client/sockettest"
+)
+
+// parentTracer keeps the parent span of the spans started by name, and
+// the spans themselves.
+type parentTracer struct {
+	lock    sync.Mutex
+	parents map[string]trace.SpanContext
+	spans   map[string]trace.SpanContext
+}
+
+func newParentTracer() *parentTracer {
+	return &parentTracer{
+		parents: make(map[string]trace.SpanContext),
+		spans:   make(map[string]trace.SpanContext),
+	}
+}
+
+func (t *parentTracer) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return t
+}
+
+func (t *parentTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent := trace.SpanContextFromContext(ctx)
+	sc := parent.WithSpanID(trace.SpanID{0xff, byte(len(name))})
+	if !parent.TraceID().IsValid() {
+		sc = sc.WithTraceID(trace.TraceID{0xff})
+	}
+	t.lock.Lock()
+	t.parents[name] = parent
+	t.spans[name] = sc
+	t.lock.Unlock()
+	ctx = trace.ContextWithSpanContext(ctx, sc.WithRemote(false))
+	return ctx, trace.SpanFromContext(ctx)
+}
+
+func (t *parentTracer) span(name string) trace.SpanContext {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.spans[name]
+}
+
+func (t *parentTracer) parent(name string) (trace.SpanContext, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	sc, ok := t.parents[name]
+	return sc, ok
+}
+
+func TestHandlerSpanParent(t *testing.T) {
+	srv := sockettest.NewServer()
+	defer srv.Close()
+
+	tp := newParentTracer()
+	opts := &socketio_client.Options{Transport: []string{"websocket"}}
+	Instrument(opts, tp)
+	client, err := socketio_client.NewClient(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the trace a server would carry in the payload
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+		Remote:  true,
+	})
+	client.UseIncoming(func(p *socketio_client.Packet, next func()) {
+		p.SetContext(trace.ContextWithRemoteSpanContext(p.Context(), remote))
+		next()
+	})
+	got := make(chan context.Context, 1)
+	client.On("echo", func(ctx context.Context, s string) {
+		got <- ctx
+	})
+	if err := client.Emit("echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx context.Context
+	select {
+	case ctx = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo")
+	}
+	if socketio_client.ClientFromContext(ctx) != client {
+		t.Error("the handler context lost its client")
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.TraceID() != remote.TraceID() {
+		t.Errorf("handler trace %v, want %v", sc.TraceID(), remote.TraceID())
+	}
+	sc, ok := tp.parent("socket.io handle echo")
+	if !ok {
+		t.Fatal("no handler span")
+	}
+	if sc.TraceID() != remote.TraceID() || sc.SpanID() != remote.SpanID() {
+		t.Errorf("handler span parent %v/%v, want the trace of the packet", sc.TraceID(), sc.SpanID())
+	}
+	if got := trace.SpanContextFromContext(ctx).SpanID(); got != tp.span("socket.io handle echo").SpanID() {
+		t.Errorf("handler runs within span %v, want the handler span", got)
+	}
+}
+
+func TestTracePropagated(t *testing.T) {
+	srv := sockettest.NewServer()
+	defer srv.Close()
+
+	tp := newParentTracer()
+	opts := &socketio_client.Options{Transport: []string{"websocket"}}
+	Instrument(opts, tp)
+	client, err := socketio_client.NewClient(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.UseOutgoing(Inject(nil))
+	client.UseIncoming(Extract(nil))
+	args := make(chan int, 1)
+	client.UseIncoming(func(p *socketio_client.Packet, next func()) {
+		if data, ok := p.Data.([]json.RawMessage); ok {
+			args <- len(data)
+		}
+		next()
+	})
+	got := make(chan string, 1)
+	client.On("echo", func(s string) {
+		got <- s
+	})
+
+	caller := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{5},
+		SpanID:     trace.SpanID{6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	if err := client.EmitContext(trace.ContextWithSpanContext(context.Background(), caller), "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-got:
+		if s != "hi" {
+			t.Errorf("echo %q, want hi", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo")
+	}
+	if n := <-args; n != 2 {
+		t.Errorf("handler got %d values, want the event and its argument only", n)
+	}
+	sc, ok := tp.parent("socket.io handle echo")
+	if !ok {
+		t.Fatal("no handler span")
+	}
+	emit := tp.span("socket.io emit echo")
+	if sc.TraceID() != caller.TraceID() || sc.SpanID() != emit.SpanID() || !sc.IsRemote() {
+		t.Errorf("handler span parent %v/%v, want the emit span %v", sc.TraceID(), sc.SpanID(), emit.SpanID())
+	}
+}
+
+func TestEmitSpanParent(t *testing.T) {
+	srv := sockettest.NewServer()
+	defer srv.Close()
+
+	tp := newParentTracer()
+	opts := &socketio_client.Options{Transport: []string{"websocket"}}
+	Instrument(opts, tp)
+	client, err := socketio_client.NewClient(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	caller := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{3},
+		SpanID:  trace.SpanID{4},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), caller)
+	if err := client.EmitContext(ctx, "join", "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	sc, ok := tp.parent("socket.io emit join")
+	if !ok {
+		t.Fatal("no emit span")
+	}
+	if sc.TraceID() != caller.TraceID() || sc.SpanID() != caller.SpanID() {
+		t.Errorf("emit span parent %v/%v, want the span of the caller", sc.TraceID(), sc.SpanID())
+	}
+}
@@ -0,0 +1,207 @@
+package socketio_client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// Outbox holds events emitted while the client is reconnecting until they
+// can be sent. Each namespace client needs its own Outbox.
+type Outbox interface {
+	// Push appends p to the queue.
+	Push(p Packet) error
+	// Peek returns the oldest queued packet, if any.
+	Peek() (Packet, bool, error)
+	// Pop removes the oldest queued packet once it was sent.
+	Pop() error
+}
+
+type memoryOutbox struct {
+	lock    sync.Mutex
+	packets []Packet
+}
+
+func (o *memoryOutbox) Push(p Packet) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.packets = append(o.packets, p)
+	return nil
+}
+
+func (o *memoryOutbox) Peek() (Packet, bool, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.packets) == 0 {
+		return Packet{}, false, nil
+	}
+	return o.packets[0], true, nil
+}
+
+func (o *memoryOutbox) Pop() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.packets) > 0 {
+		o.packets = o.packets[1:]
+	}
+	return nil
+}
+
+var errOutboxAttachment = errors.New("attachments can't be stored in a file outbox")
+
+type outboxRecord struct {
+	Pop  bool            `json:"pop,omitempty"`
+	Type PacketType      `json:"type,omitempty"`
+	NSP  string          `json:"nsp,omitempty"`
+	Id   int             `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Seq  uint64          `json:"seq,omitempty"` //order of the event across namespaces
+}
+
+// FileOutbox is an Outbox persisted to an append-only file, so queued
+// events survive a process restart. Events with attachments are rejected.
+type FileOutbox struct {
+	lock    sync.Mutex
+	file    *os.File
+	packets []Packet
+}
+
+// OpenFileOutbox opens or creates the outbox stored at path and loads the
+// events still queued in it.
+func OpenFileOutbox(path string) (*FileOutbox, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	o := &FileOutbox{
+		file: file,
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<26)
+	var size int64 //of the records loaded, with their newlines
+	for scanner.Scan() {
+		var r outboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// a torn write at the end of the file
+			break
+		}
+		size += int64(len(scanner.Bytes())) + 1
+		if r.Pop {
+			if len(o.packets) > 0 {
+				o.packets = o.packets[1:]
+			}
+			continue
+		}
+		o.packets = append(o.packets, Packet{
+			Type: r.Type,
+			NSP:  r.NSP,
+			Id:   r.Id,
+			Data: r.Data,
+			seq:  r.Seq,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := o.compact(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := o.truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// truncate drops what follows the first size bytes of the file, such as a
+// torn write, so that later records are not appended after it.
+func (o *FileOutbox) truncate(size int64) error {
+	info, err := o.file.Stat()
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Size() == 0 || info.Size() == size:
+		return nil
+	case info.Size() < size:
+		// the last record lost its newline only
+		_, err = o.file.Write([]byte{'\n'})
+	default:
+		err = o.file.Truncate(size)
+	}
+	if err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+func (o *FileOutbox) Push(p Packet) error {
+	if len(encodeAttachments(p.Data)) > 0 {
+		return errOutboxAttachment
+	}
+	data, err := marshalData(p.Data)
+	if err != nil {
+		return err
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err := o.append(outboxRecord{Type: p.Type, NSP: p.NSP, Id: p.Id, Data: data, Seq: p.seq}); err != nil {
+		return err
+	}
+	p.Data = json.RawMessage(data)
+	o.packets = append(o.packets, p)
+	return nil
+}
+
+func (o *FileOutbox) Peek() (Packet, bool, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.packets) == 0 {
+		return Packet{}, false, nil
+	}
+	return o.packets[0], true, nil
+}
+
+func (o *FileOutbox) Pop() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.packets) == 0 {
+		return nil
+	}
+	o.packets = o.packets[1:]
+	if len(o.packets) == 0 {
+		return o.compact()
+	}
+	return o.append(outboxRecord{Pop: true})
+}
+
+// Close closes the underlying file.
+func (o *FileOutbox) Close() error {
+	return o.file.Close()
+}
+
+func (o *FileOutbox) append(r outboxRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+// compact truncates the file once nothing is queued.
+func (o *FileOutbox) compact() error {
+	if len(o.packets) > 0 {
+		return nil
+	}
+	if err := o.file.Truncate(0); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
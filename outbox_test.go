@@ -0,0 +1,324 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboxFlushedOnConnectAck(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		conns = make(map[*MemoryConn]int)
+		acked bool
+	)
+	result := make(chan bool, 1)
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		lock.Lock()
+		n, ok := conns[conn]
+		if !ok {
+			n = len(conns) + 1
+			conns[conn] = n
+		}
+		lock.Unlock()
+		switch {
+		case n == 1 && bytes.HasPrefix(f.Data, []byte(`42/chat,["start"`)):
+			conn.Close()
+			return true
+		case n == 2 && bytes.HasPrefix(f.Data, []byte("40/chat")):
+			// answered late, the queued event must wait for it
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				lock.Lock()
+				acked = true
+				lock.Unlock()
+				conn.WriteFrame(f)
+			}()
+			return true
+		case n == 2 && bytes.HasPrefix(f.Data, []byte(`42/chat,["queued"`)):
+			lock.Lock()
+			result <- acked
+			lock.Unlock()
+			return true
+		}
+		return false
+	})
+	opts := memoryOptions()
+	opts.Namespace = "/chat"
+	opts.Reconnection = true
+	opts.ReconnectionDelay = 10 * time.Millisecond
+	opts.BufferEmits = true
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.On("disconnection", func() {
+		// queued while reconnecting
+		client.Emit("queued")
+	})
+	client.Emit("start")
+	select {
+	case acked := <-result:
+		if !acked {
+			t.Fatal("queued event sent before the CONNECT was answered")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued event not sent")
+	}
+}
+
+func TestFileOutboxRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+	o, err := OpenFileOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, seq := range []uint64{5, 9, 12} {
+		p := Packet{Type: _EVENT, NSP: "/a", Id: -1, Data: []interface{}{"ev", i}, seq: seq}
+		if err := o.Push(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Pop(); err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+
+	o, err = OpenFileOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	for _, want := range []struct {
+		seq  uint64
+		data string
+	}{{9, `["ev",1]`}, {12, `["ev",2]`}} {
+		p, ok, err := o.Peek()
+		if err != nil || !ok {
+			t.Fatalf("Peek() = %v, %v", ok, err)
+		}
+		if p.seq != want.seq || p.NSP != "/a" || string(p.Data.(json.RawMessage)) != want.data {
+			t.Errorf("got seq %d %s %s, want seq %d %s", p.seq, p.NSP, p.Data, want.seq, want.data)
+		}
+		o.Pop()
+	}
+	if _, ok, _ := o.Peek(); ok {
+		t.Error("popped events replayed")
+	}
+}
+
+func TestFileOutboxTornWrite(t *testing.T) {
+	// a crash in the middle of the next record, or before the newline of
+	// the last one
+	for _, torn := range []func(b []byte) []byte{
+		func(b []byte) []byte { return append(b, `{"type":2,"nsp":"/a","da`...) },
+		func(b []byte) []byte { return b[:len(b)-1] },
+	} {
+		path := filepath.Join(t.TempDir(), "outbox")
+		o, err := OpenFileOutbox(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Push(Packet{Type: _EVENT, Id: -1, Data: []interface{}{"first"}}); err != nil {
+			t.Fatal(err)
+		}
+		o.Close()
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = torn(b)
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if o, err = OpenFileOutbox(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Push(Packet{Type: _EVENT, Id: -1, Data: []interface{}{"second"}}); err != nil {
+			t.Fatal(err)
+		}
+		o.Close()
+
+		if o, err = OpenFileOutbox(path); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for {
+			p, ok, err := o.Peek()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			got = append(got, string(p.Data.(json.RawMessage)))
+			o.Pop()
+		}
+		o.Close()
+		if want := []string{`["first"]`, `["second"]`}; !reflect.DeepEqual(got, want) {
+			t.Errorf("file %q: events %q, want %q", b, got, want)
+		}
+	}
+}
+
+// eventServer drops the first connection on the event "start" and records
+// the events received on the next ones, answering the CONNECT of /a late.
+type eventServer struct {
+	lock   sync.Mutex
+	conns  map[*MemoryConn]int
+	events []string
+	got    chan struct{}
+	want   int
+}
+
+func newEventServer(t *testing.T, want int) (*eventServer, string) {
+	s := &eventServer{conns: make(map[*MemoryConn]int), got: make(chan struct{}), want: want}
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		n, ok := s.conns[conn]
+		if !ok {
+			n = len(s.conns) + 1
+			s.conns[conn] = n
+		}
+		switch {
+		case n == 1 && bytes.Contains(f.Data, []byte(`["start"`)):
+			conn.Close()
+			return true
+		case n > 1 && bytes.HasPrefix(f.Data, []byte("40/a")):
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				conn.WriteFrame(f)
+			}()
+			return true
+		case n > 1 && bytes.HasPrefix(f.Data, []byte("42")):
+			var args []string
+			i := bytes.IndexByte(f.Data, '[')
+			json.Unmarshal(f.Data[i:], &args)
+			s.events = append(s.events, args[0])
+			if len(s.events) == s.want {
+				close(s.got)
+			}
+			return true
+		}
+		return false
+	})
+	return s, uri
+}
+
+func (s *eventServer) wait(t *testing.T) []string {
+	select {
+	case <-s.got:
+	case <-time.After(5 * time.Second):
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.events...)
+}
+
+func TestOutboxOrderAcrossNamespaces(t *testing.T) {
+	srv, uri := newEventServer(t, 5)
+	file, err := OpenFileOutbox(filepath.Join(t.TempDir(), "outbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	clients := make(map[string]*Client)
+	for _, nsp := range []string{"/a", "/b", "/c"} {
+		opts := memoryOptions()
+		opts.Namespace = nsp
+		opts.Reconnection = true
+		opts.ReconnectionDelay = 10 * time.Millisecond
+		switch nsp {
+		case "/a":
+			opts.Outbox = file
+		case "/b":
+			opts.BufferEmits = true
+		}
+		client, err := NewClient(uri, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		clients[nsp] = client
+	}
+	clients["/a"].On("disconnection", func() {
+		clients["/a"].Emit("a1")
+		clients["/b"].Emit("b1")
+		clients["/a"].Emit("a2")
+	})
+	clients["/c"].On("reconnect", func() {
+		// /c has no outbox, its event waits for the queued ones
+		clients["/c"].Emit("c1")
+		clients["/b"].Emit("b2")
+	})
+	clients["/a"].Emit("start")
+
+	want := []string{"a1", "b1", "a2", "c1", "b2"}
+	if got := srv.wait(t); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events %q, want %q", got, want)
+	}
+}
+
+func TestFileOutboxReplayedAfterRestart(t *testing.T) {
+	srv, uri := newEventServer(t, 3)
+	path := filepath.Join(t.TempDir(), "outbox")
+
+	// the first process queues events while disconnected, then exits
+	o, err := OpenFileOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := memoryOptions()
+	opts.Namespace = "/a"
+	opts.Reconnection = true
+	opts.ReconnectionDelay = time.Minute
+	opts.Outbox = o
+	first, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan struct{})
+	var once sync.Once
+	first.On("disconnection", func() {
+		// fired again by Close
+		once.Do(func() {
+			first.Emit("old1")
+			first.Emit("old2")
+			close(queued)
+		})
+	})
+	first.Emit("start")
+	<-queued
+	first.Close()
+	o.Close()
+
+	if o, err = OpenFileOutbox(path); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	opts = memoryOptions()
+	opts.Namespace = "/a"
+	opts.Outbox = o
+	second, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.Emit("new")
+
+	if got, want := srv.wait(t), []string{"old1", "old2", "new"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events %q, want %q", got, want)
+	}
+	if _, ok, _ := o.Peek(); ok {
+		t.Error("replayed events still queued")
+	}
+}
@@ -0,0 +1,151 @@
+// Package packet encodes and decodes the text frames of socket.io packets,
+// as pure functions over byte slices with no connection involved, for
+// fuzzing the parser or reusing it in servers and tools:
+//
+//	p, err := packet.Decode([]byte(`2/chat,12["message","hi"]`))
+//	// p.Type == packet.Event, p.NSP == "/chat", p.Id == 12
+//	// string(p.Data) == `["message","hi"]`
+//	frame := packet.Append(nil, p)
+//
+// Only the frame is handled: the JSON of Data, and the binary frames
+// following binary packets, are left to the caller.
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Type is the type of a socket.io packet.
+type Type int
+
+const (
+	Connect Type = iota
+	Disconnect
+	Event
+	Ack
+	Error
+	BinaryEvent
+	BinaryAck
+)
+
+func (t Type) String() string {
+	switch t {
+	case Connect:
+		return "connect"
+	case Disconnect:
+		return "disconnect"
+	case Event:
+		return "event"
+	case Ack:
+		return "ack"
+	case Error:
+		return "error"
+	case BinaryEvent:
+		return "binary_event"
+	case BinaryAck:
+		return "binary_ack"
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
+
+// Valid tells whether t is a type of the protocol.
+func (t Type) Valid() bool {
+	return t >= Connect && t <= BinaryAck
+}
+
+// Binary tells whether packets of type t are followed by binary frames.
+func (t Type) Binary() bool {
+	return t == BinaryEvent || t == BinaryAck
+}
+
+// ErrInvalid is wrapped by the errors of Decode.
+var ErrInvalid = errors.New("invalid packet")
+
+// Packet is the content of a text frame.
+type Packet struct {
+	Type        Type
+	NSP         string //empty for the default namespace
+	Id          int    //-1 when no ack is requested
+	Attachments int    //binary frames following a binary packet
+	Data        []byte //JSON after the id, such as the array of an event, nil when none
+}
+
+// Decode returns the packet of frame. Data points into frame. Packets of
+// unknown types are decoded as the others, Type.Valid telling them apart.
+func Decode(frame []byte) (Packet, error) {
+	p := Packet{Id: -1}
+	if len(frame) == 0 {
+		return p, fmt.Errorf("%w: empty frame", ErrInvalid)
+	}
+	p.Type = Type(frame[0]) - '0'
+	rest := frame[1:]
+
+	if p.Type.Binary() {
+		i := bytes.IndexByte(rest, '-')
+		if i < 0 {
+			return p, fmt.Errorf("%w: no attachment count", ErrInvalid)
+		}
+		n, err := strconv.ParseInt(string(rest[:i]), 10, 0)
+		if err != nil {
+			return p, fmt.Errorf("%w: attachment count %q", ErrInvalid, rest[:i])
+		}
+		p.Attachments = int(n)
+		rest = rest[i+1:]
+	}
+
+	if len(rest) > 0 && rest[0] == '/' {
+		i := bytes.IndexByte(rest, ',')
+		if i < 0 {
+			p.NSP = string(rest)
+			return p, nil
+		}
+		p.NSP, rest = string(rest[:i]), rest[i+1:]
+	}
+
+	i := 0
+	for i < len(rest) && '0' <= rest[i] && rest[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		id, err := strconv.ParseInt(string(rest[:i]), 10, 0)
+		if err != nil {
+			return p, fmt.Errorf("%w: ack id %q", ErrInvalid, rest[:i])
+		}
+		p.Id = int(id)
+	}
+	if i < len(rest) {
+		p.Data = rest[i:]
+	}
+	return p, nil
+}
+
+// Append appends the frame of p to dst and returns it.
+func Append(dst []byte, p Packet) []byte {
+	dst = append(dst, byte(p.Type)+'0')
+	if p.Type.Binary() {
+		dst = strconv.AppendInt(dst, int64(p.Attachments), 10)
+		dst = append(dst, '-')
+	}
+	needEnd := false
+	if p.NSP != "" {
+		dst = append(dst, p.NSP...)
+		needEnd = true
+	}
+	if p.Id >= 0 {
+		if needEnd {
+			dst = append(dst, ',')
+			needEnd = false
+		}
+		dst = strconv.AppendInt(dst, int64(p.Id), 10)
+	}
+	if len(p.Data) > 0 {
+		if needEnd {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, p.Data...)
+	}
+	return dst
+}
@@ -0,0 +1,70 @@
+package packet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		frame string
+		p     Packet
+	}{
+		{`0`, Packet{Type: Connect, Id: -1}},
+		{`0/chat`, Packet{Type: Connect, NSP: "/chat", Id: -1}},
+		{`1/chat`, Packet{Type: Disconnect, NSP: "/chat", Id: -1}},
+		{`2["message","hi"]`, Packet{Type: Event, Id: -1, Data: []byte(`["message","hi"]`)}},
+		{`2/chat,12["message","hi"]`, Packet{Type: Event, NSP: "/chat", Id: 12, Data: []byte(`["message","hi"]`)}},
+		{`3/chat,7`, Packet{Type: Ack, NSP: "/chat", Id: 7}},
+		{`4/admin,"not authorized"`, Packet{Type: Error, NSP: "/admin", Id: -1, Data: []byte(`"not authorized"`)}},
+		{`51-["file",{"_placeholder":true,"num":0}]`, Packet{Type: BinaryEvent, Id: -1, Attachments: 1, Data: []byte(`["file",{"_placeholder":true,"num":0}]`)}},
+		{`62-/chat,4[]`, Packet{Type: BinaryAck, NSP: "/chat", Id: 4, Attachments: 2, Data: []byte(`[]`)}},
+	}
+	for _, tt := range tests {
+		p, err := Decode([]byte(tt.frame))
+		if err != nil {
+			t.Errorf("Decode(%q): %v", tt.frame, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, tt.p) {
+			t.Errorf("Decode(%q) = %+v, want %+v", tt.frame, p, tt.p)
+		}
+		if got := string(Append(nil, tt.p)); got != tt.frame {
+			t.Errorf("Append(%+v) = %q, want %q", tt.p, got, tt.frame)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, frame := range []string{``, `5`, `5x-[]`, `6-1-[]`, `2/chat,99999999999999999999[]`} {
+		if _, err := Decode([]byte(frame)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Decode(%q) error %v, want ErrInvalid", frame, err)
+		}
+	}
+}
+
+// FuzzDecode checks that the packets Decode returns are encoded by Append
+// into frames decoding to the same packets.
+func FuzzDecode(f *testing.F) {
+	for _, frame := range []string{
+		``, `0`, `0/chat`, `3/chat,`, `2["a"]`, `2/chat,12["a",1]`, `4/admin,"no"`,
+		`51-["a",{"_placeholder":true,"num":0}]`, `63-/x,4[]`, `5-`, `9zz`,
+	} {
+		f.Add([]byte(frame))
+	}
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		p, err := Decode(frame)
+		if err != nil {
+			return
+		}
+		out := Append(nil, p)
+		q, err := Decode(out)
+		if err != nil {
+			t.Fatalf("%q encoded as %q: %v", frame, out, err)
+		}
+		if !reflect.DeepEqual(q, p) {
+			t.Fatalf("%q encoded as %q: decoded %+v, want %+v", frame, out, q, p)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package socketio_client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+)
+
+// PanicError is passed to Options.TraceHandler when an event handler
+// panicked. The panic is recovered and the connection goes on.
+type PanicError struct {
+	Event     string      //event of the handler, "ack" for ack callbacks
+	Recovered interface{} //value passed to panic
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler of %q panicked: %v", e.Event, e.Recovered)
+}
+
+// invoke calls c, the handler of event, with ctx or the handler context when
+// nil, recovering a panic which is logged and passed to
+// Options.OnHandlerPanic.
+func (client *Client) invoke(ctx context.Context, event string, c *caller, args []interface{}) (ret []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Event: event, Recovered: r, Stack: debug.Stack()}
+			client.manager.log.Errorf("socket.io %s: %v\n%s", client.Namespace(), panicErr, panicErr.Stack)
+			if f := client.opts.OnHandlerPanic; f != nil {
+				f(event, r, panicErr.Stack)
+			}
+			ret, err = nil, panicErr
+		}
+	}()
+	if ctx == nil {
+		ctx = client.handlerContext()
+	}
+	if c.pattern && c.ctx {
+		ctx = context.WithValue(ctx, eventKey{}, event)
+	}
+	return c.Call(ctx, args), nil
+}
@@ -1,21 +1,24 @@
 package socketio_client
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/h2570su/go-socket.io-client/packet"
 )
 
 const Protocol = 4
 
-type packetType int
+// PacketType is the type of a socket.io packet.
+type PacketType int
 
 const (
-	_CONNECT packetType = iota
+	_CONNECT PacketType = iota
 	_DISCONNECT
 	_EVENT
 	_ACK
@@ -24,7 +27,18 @@ const (
 	_BINARY_ACK
 )
 
-func (t packetType) String() string {
+// Packet types visible to middleware.
+const (
+	PacketConnect     = _CONNECT
+	PacketDisconnect  = _DISCONNECT
+	PacketEvent       = _EVENT
+	PacketAck         = _ACK
+	PacketError       = _ERROR
+	PacketBinaryEvent = _BINARY_EVENT
+	PacketBinaryAck   = _BINARY_ACK
+)
+
+func (t PacketType) String() string {
 	switch t {
 	case _CONNECT:
 		return "connect"
@@ -52,31 +66,99 @@ type frameWriter interface {
 	NextWriter(MessageType) (io.WriteCloser, error)
 }
 
-type packet struct {
-	Type         packetType
+// Packet is a socket.io packet. For events Data holds the event name
+// followed by its arguments; Id is -1 when no ack is requested.
+type Packet struct {
+	Type         PacketType
 	NSP          string
 	Id           int
 	Data         interface{}
 	attachNumber int
+	seq          uint64
+	ctx          context.Context //gives up writing the packet once done, when not nil
+}
+
+// Context returns the context carried with p. For an incoming packet it is
+// the context of its handlers, see SetContext.
+func (p *Packet) Context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// SetContext replaces the context carried with p. An incoming middleware
+// can derive one from Context, such as with a trace extracted from the
+// payload, and the handlers of p and Options.TraceHandler get it. Writing
+// an outgoing packet gives up once its context is done.
+func (p *Packet) SetContext(ctx context.Context) {
+	p.ctx = ctx
 }
 
 type encoder struct {
-	w   frameWriter
-	err error
+	w      frameWriter
+	err    error
+	tracer Tracer
+	parser Parser     //see Options.Parser
+	max    int        //see Options.MaxPayload
+	sent   PacketType //type of the last packet on the wire
 }
 
-func newEncoder(w frameWriter) *encoder {
+func newEncoder(w frameWriter, tracer Tracer, parser Parser) *encoder {
 	return &encoder{
-		w: w,
+		w:      w,
+		tracer: tracer,
+		parser: parser,
+	}
+}
+
+func (e *encoder) Encode(v Packet) error {
+	var buf *frameBuffer
+	w := e.w
+	if e.max > 0 {
+		buf = &frameBuffer{}
+		e.w = buf
+		defer func() { e.w = w }()
+	}
+	var rec *frameRecorder
+	if e.tracer != nil {
+		rec = &frameRecorder{frameWriter: e.w}
+		e.w = rec
+		defer func() { e.w = rec.frameWriter }()
+	}
+	if e.parser != nil {
+		e.sent = v.Type
+		if err := e.encodeParsed(v); err != nil {
+			return err
+		}
+	} else if err := e.encodeJSON(v); err != nil {
+		return err
+	}
+	if buf != nil {
+		if err := buf.flush(w, e.max); err != nil {
+			return err
+		}
+	}
+	if rec != nil && len(rec.frames) > 0 {
+		e.tracer.OnPacketSent(WirePacket{
+			Outgoing:    true,
+			Type:        v.Type,
+			Namespace:   v.NSP,
+			Payload:     rec.frames[0],
+			Attachments: rec.frames[1:],
+			Time:        time.Now(),
+		})
 	}
+	return nil
 }
 
-func (e *encoder) Encode(v packet) error {
+func (e *encoder) encodeJSON(v Packet) error {
 	attachments := encodeAttachments(v.Data)
 	v.attachNumber = len(attachments)
 	if v.attachNumber > 0 {
 		v.Type += _BINARY_EVENT - _EVENT
 	}
+	e.sent = v.Type
 	if err := e.encodePacket(v); err != nil {
 		return err
 	}
@@ -88,44 +170,41 @@ func (e *encoder) Encode(v packet) error {
 	return nil
 }
 
-func (e *encoder) encodePacket(v packet) error {
+func (e *encoder) encodePacket(v Packet) error {
+	// the packet is put together in pooled buffers and written at once
+	data := getBuffer()
+	defer putBuffer(data)
+	if v.Data != nil {
+		if args, ok := preencodedArgs(v.Data); ok {
+			if err := writePreencoded(data, v.Data.([]interface{}), args); err != nil {
+				return err
+			}
+		} else if err := json.NewEncoder(data).Encode(v.Data); err != nil {
+			return err
+		} else {
+			data.Truncate(len(bytes.TrimRight(data.Bytes(), "\n")))
+		}
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.Grow(data.Len() + len(v.NSP) + 48)
+	frame := packet.Append(buf.Bytes(), packet.Packet{
+		Type:        packet.Type(v.Type),
+		NSP:         v.NSP,
+		Id:          v.Id,
+		Attachments: v.attachNumber,
+		Data:        data.Bytes(),
+	})
+
 	writer, err := e.w.NextWriter(MessageText)
 	if err != nil {
 		return err
 	}
-	defer writer.Close()
-
-	w := newTrimWriter(writer, "\n")
-	wh := newWriterHelper(w)
-	wh.Write([]byte{byte(v.Type) + '0'})
-	if v.Type == _BINARY_EVENT || v.Type == _BINARY_ACK {
-		wh.Write([]byte(fmt.Sprintf("%d-", v.attachNumber)))
-	}
-	needEnd := false
-	if v.NSP != "" {
-		wh.Write([]byte(v.NSP))
-		needEnd = true
-	}
-	if v.Id >= 0 {
-		f := "%d"
-		if needEnd {
-			f = ",%d"
-			needEnd = false
-		}
-		wh.Write([]byte(fmt.Sprintf(f, v.Id)))
-	}
-	if v.Data != nil {
-		if needEnd {
-			wh.Write([]byte{','})
-			needEnd = false
-		}
-		if wh.Error() != nil {
-			return wh.Error()
-		}
-		encoder := json.NewEncoder(w)
-		return encoder.Encode(v.Data)
+	if _, err := writer.Write(frame); err != nil {
+		writer.Close()
+		return err
 	}
-	return wh.Error()
+	return writer.Close()
 }
 
 func (e *encoder) writeBinary(r io.Reader) error {
@@ -142,11 +221,33 @@ func (e *encoder) writeBinary(r io.Reader) error {
 
 }
 
+// ProtocolViolation describes a packet from the server that breaks the
+// socket.io protocol. It is returned and reported through
+// Options.OnProtocolViolation when Options.StrictProtocol is set.
+type ProtocolViolation struct {
+	Reason string
+	Packet string //the offending text frame, if any
+}
+
+func (v *ProtocolViolation) Error() string {
+	return "protocol violation: " + v.Reason
+}
+
 type decoder struct {
-	reader        frameReader
-	message       string
-	current       io.Reader
-	currentCloser io.Closer
+	reader frameReader
+	strict bool
+	tracer Tracer
+	parser Parser //see Options.Parser
+
+	useNumber             bool //see Options.JSONUseNumber
+	disallowUnknownFields bool //see Options.JSONDisallowUnknownFields
+
+	frame   []byte
+	message string
+	args    []json.RawMessage
+	binary  [][]byte
+	size    int
+	data    int //bytes of the JSON array ending frame
 }
 
 func newDecoder(r frameReader) *decoder {
@@ -156,181 +257,243 @@ func newDecoder(r frameReader) *decoder {
 }
 
 func (d *decoder) Close() {
-	if d != nil && d.currentCloser != nil {
-		d.currentCloser.Close()
-		d.current = nil
-		d.currentCloser = nil
+	if d != nil {
+		d.args = nil
+		d.binary = nil
 	}
 }
 
-func (d *decoder) Decode(v *packet) error {
-	ty, r, err := d.reader.NextReader()
-	if err != nil {
+func (d *decoder) Decode(v *Packet) error {
+	if err := d.decode(v); err != nil {
 		return err
 	}
-	if d.current != nil {
-		d.Close()
+	if d.tracer != nil {
+		d.tracer.OnPacketReceived(WirePacket{
+			Type:        v.Type,
+			Namespace:   v.NSP,
+			Payload:     d.frame,
+			Attachments: d.binary,
+			Time:        time.Now(),
+		})
 	}
-	defer func() {
-		if d.current == nil {
-			r.Close()
-		}
-	}()
+	return nil
+}
 
-	if ty != MessageText {
-		return fmt.Errorf("need text package")
+func (d *decoder) decode(v *Packet) error {
+	ty, r, err := d.reader.NextReader()
+	if err != nil {
+		return err
 	}
-	reader := bufio.NewReader(r)
-
-	v.Id = -1
-
-	t, err := reader.ReadByte()
+	d.Close()
+	d.message = ""
+	d.size = 0
+	d.data = 0
+	d.frame, err = readAll(r)
+	r.Close()
 	if err != nil {
 		return err
 	}
-	v.Type = packetType(t - '0')
+	if d.parser != nil {
+		return d.decodeParsed(ty, v)
+	}
 
-	if v.Type == _BINARY_EVENT || v.Type == _BINARY_ACK {
-		num, err := reader.ReadBytes('-')
-		if err != nil {
-			return err
-		}
-		numLen := len(num)
-		if numLen == 0 {
-			return fmt.Errorf("invalid packet")
-		}
-		n, err := strconv.ParseInt(string(num[:numLen-1]), 10, 64)
-		if err != nil {
-			return fmt.Errorf("invalid packet")
+	if ty != MessageText {
+		if d.strict {
+			return d.violation("binary frame outside of a binary packet")
 		}
-		v.attachNumber = int(n)
+		return fmt.Errorf("need text package")
 	}
-
-	next, err := reader.Peek(1)
-	if err == io.EOF {
-		return nil
+	if d.strict && !utf8.Valid(d.frame) {
+		return d.violation("invalid UTF-8")
 	}
+	p, err := packet.Decode(d.frame)
+	v.Type, v.NSP, v.Id, v.attachNumber = PacketType(p.Type), p.NSP, p.Id, p.Attachments
 	if err != nil {
 		return err
 	}
-	if len(next) == 0 {
-		return fmt.Errorf("invalid packet")
+	if d.strict && !p.Type.Valid() {
+		return d.violation(fmt.Sprintf("unknown packet type %q", d.frame[0]))
 	}
-
-	if next[0] == '/' {
-		path, err := reader.ReadBytes(',')
-		if err != nil && err != io.EOF {
-			return err
-		}
-		pathLen := len(path)
-		if pathLen == 0 {
-			return fmt.Errorf("invalid packet")
-		}
-		if err == nil {
-			path = path[:pathLen-1]
-		}
-		v.NSP = string(path)
-		if err == io.EOF {
-			return nil
-		}
+	if d.strict && (v.Type == _ACK || v.Type == _BINARY_ACK) && v.Id < 0 {
+		return d.violation("ack without id")
 	}
-
-	id := bytes.NewBuffer(nil)
-	finish := false
-	for {
-		next, err := reader.Peek(1)
-		if err == io.EOF {
-			finish = true
-			break
-		}
-		if err != nil {
-			return err
+	switch v.Type {
+	case _EVENT, _BINARY_EVENT, _ACK, _BINARY_ACK:
+	default:
+		return nil
+	}
+	if p.Data == nil {
+		return nil
+	}
+	payload := p.Data
+	d.size = len(payload)
+	d.data = len(payload)
+	var data []json.RawMessage
+	if err := json.Unmarshal(payload, &data); err != nil {
+		if d.strict {
+			return d.violation(fmt.Sprintf("payload is not a JSON array: %v", err))
 		}
-		if '0' <= next[0] && next[0] <= '9' {
-			if err := id.WriteByte(next[0]); err != nil {
-				return err
-			}
-		} else {
-			break
+		return err
+	}
+	v.Data = data
+	if err := d.load(v); err != nil {
+		if d.strict {
+			return d.violation(fmt.Sprintf("invalid event name: %v", err))
 		}
-		reader.ReadByte()
+		return err
 	}
-	if id.Len() > 0 {
-		id, err := strconv.ParseInt(id.String(), 10, 64)
-		if err != nil {
+	if v.Type == _BINARY_EVENT || v.Type == _BINARY_ACK {
+		if d.binary, err = d.decodeBinary(v.attachNumber); err != nil {
 			return err
 		}
-		v.Id = int(id)
 	}
-	if finish {
+	return nil
+}
+
+// load takes the event name and arguments from v.Data, which holds the raw
+// JSON elements of an incoming event or ack.
+func (d *decoder) load(v *Packet) error {
+	d.message = ""
+	d.args, _ = v.Data.([]json.RawMessage)
+	if d.args == nil || (v.Type != _EVENT && v.Type != _BINARY_EVENT) {
 		return nil
 	}
-
-	switch v.Type {
-	case _EVENT:
-		fallthrough
-	case _BINARY_EVENT:
-		msgReader, err := newMessageReader(reader)
-		if err != nil {
-			return err
-		}
-		d.message = msgReader.Message()
-		d.current = msgReader
-		d.currentCloser = r
-	case _ACK:
-		fallthrough
-	case _BINARY_ACK:
-		d.current = reader
-		d.currentCloser = r
+	if len(d.args) == 0 {
+		return fmt.Errorf("invalid packet")
 	}
+	if err := d.unmarshal(d.args[0], &d.message); err != nil {
+		return err
+	}
+	d.args = d.args[1:]
 	return nil
 }
 
+func (d *decoder) violation(reason string) error {
+	return &ProtocolViolation{
+		Reason: reason,
+		Packet: string(d.frame),
+	}
+}
+
+// wireSize returns the size of the frames of the last decoded packet.
+func (d *decoder) wireSize() int {
+	n := len(d.frame)
+	for _, b := range d.binary {
+		n += len(b)
+	}
+	return n
+}
+
 func (d *decoder) Message() string {
 	return d.message
 }
 
-func (d *decoder) DecodeData(v *packet) error {
-	if d.current == nil {
+// Size returns the number of payload bytes of the last decoded packet,
+// attachments included.
+func (d *decoder) Size() int {
+	if d == nil {
+		return 0
+	}
+	return d.size
+}
+
+// argCount returns the number of arguments of the last decoded packet.
+func (d *decoder) argCount() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.args)
+}
+
+// rawArgs returns the undecoded arguments of the last decoded packet, the
+// placeholders of its attachments included, and releases the decoder.
+func (d *decoder) rawArgs() *[]json.RawMessage {
+	args := d.args
+	d.Close()
+	return &args
+}
+
+// payload returns the JSON array of the last decoded packet, event name
+// included.
+func (d *decoder) payload() []byte {
+	return d.frame[len(d.frame)-d.data:]
+}
+
+// DecodeData decodes the packet arguments into v.Data, which must point to a
+// slice of pointers such as the one returned by caller.GetArgs.
+func (d *decoder) DecodeData(v *Packet) error {
+	if d.args == nil {
 		return nil
 	}
 	defer func() {
 		d.Close()
 	}()
-	decoder := json.NewDecoder(d.current)
-	if err := decoder.Decode(v.Data); err != nil {
-		return err
+	args, ok := v.Data.(*[]interface{})
+	if !ok {
+		return fmt.Errorf("invalid data %T", v.Data)
 	}
-	if v.Type == _BINARY_EVENT || v.Type == _BINARY_ACK {
-		binary, err := d.decodeBinary(v.attachNumber)
-		if err != nil {
-			return err
+	for i, arg := range *args {
+		if i >= len(d.args) {
+			break
 		}
-		if err := decodeAttachments(v.Data, binary); err != nil {
+		if raw, ok := arg.(*json.RawMessage); ok && d.binary == nil {
+			// handed over as is
+			*raw = d.args[i]
+			continue
+		}
+		if err := d.unmarshal(d.args[i], arg); err != nil {
 			return err
 		}
+		if d.binary != nil {
+			if err := decodeAttachments(arg, d.binary); err != nil {
+				return err
+			}
+		}
+	}
+	if v.Type == _BINARY_EVENT || v.Type == _BINARY_ACK {
 		v.Type -= _BINARY_EVENT - _EVENT
 	}
 	return nil
 }
 
+// unmarshal decodes the argument data into v as configured by the options.
+func (d *decoder) unmarshal(data []byte, v interface{}) error {
+	if d.parser != nil {
+		return d.unmarshalParsed(data, v)
+	}
+	if !d.useNumber && !d.disallowUnknownFields {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if d.useNumber {
+		dec.UseNumber()
+	}
+	if d.disallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
 func (d *decoder) decodeBinary(num int) ([][]byte, error) {
 	ret := make([][]byte, num)
 	for i := 0; i < num; i++ {
-		d.currentCloser.Close()
 		t, r, err := d.reader.NextReader()
 		if err != nil {
 			return nil, err
 		}
-		d.currentCloser = r
-		if t == MessageText {
-			return nil, fmt.Errorf("need binary")
-		}
-		b, err := ioutil.ReadAll(r)
+		b, err := readAll(r)
+		r.Close()
 		if err != nil {
 			return nil, err
 		}
+		if t == MessageText {
+			if d.strict {
+				return nil, d.violation(fmt.Sprintf("expected %d attachments, got %d", num, i))
+			}
+			return nil, fmt.Errorf("need binary")
+		}
 		ret[i] = b
+		d.size += len(b)
 	}
 	return ret, nil
 }
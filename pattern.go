@@ -0,0 +1,97 @@
+package socketio_client
+
+import (
+	"context"
+	"strings"
+)
+
+type eventKey struct{}
+
+// patternHandler is a handler registered with OnPattern or OnMatch.
+type patternHandler struct {
+	pattern string //as given to OnPattern, "" for OnMatch
+	match   func(event string) bool
+	caller  *caller
+}
+
+// EventFromContext returns the name of the event handled by the pattern
+// handler that got ctx, "" when ctx does not come from one.
+func EventFromContext(ctx context.Context) string {
+	event, _ := ctx.Value(eventKey{}).(string)
+	return event
+}
+
+// OnPattern registers f as the handler of the events from the server whose
+// name matches pattern, in which * stands for any run of characters:
+// "user.*" matches "user.created" as well as "user.profile.updated".
+// Handlers registered with On come first, then patterns in the order they
+// were registered; registering a pattern again replaces its handler. f gets
+// the event name from EventFromContext when it takes a context.
+func (client *Client) OnPattern(pattern string, f interface{}) error {
+	return client.onMatch(pattern, func(event string) bool {
+		return matchPattern(pattern, event)
+	}, f)
+}
+
+// OnMatch is OnPattern for events matched by match, such as the
+// MatchString method of a regexp.Regexp.
+func (client *Client) OnMatch(match func(event string) bool, f interface{}) error {
+	return client.onMatch("", match, f)
+}
+
+func (client *Client) onMatch(pattern string, match func(event string) bool, f interface{}) error {
+	c, err := newCaller(f)
+	if err != nil {
+		return err
+	}
+	c.pattern = true
+	h := patternHandler{pattern: pattern, match: match, caller: c}
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	c.seq = client.nextSeqLocked()
+	for i, p := range client.patterns {
+		if pattern != "" && p.pattern == pattern {
+			client.patterns[i] = h
+			return nil
+		}
+	}
+	client.patterns = append(client.patterns, h)
+	return nil
+}
+
+// handler returns the handler of the event from the server named event.
+func (client *Client) handler(event string) (*caller, bool) {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	if c, ok := client.events[event]; ok {
+		return c, true
+	}
+	for _, p := range client.patterns {
+		if p.match(event) {
+			return p.caller, true
+		}
+	}
+	return nil, false
+}
+
+// matchPattern reports whether name matches pattern, * standing for any
+// run of characters.
+func matchPattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return len(name) >= len(last) && strings.HasSuffix(name, last)
+}
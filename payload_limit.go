@@ -0,0 +1,58 @@
+package socketio_client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrPayloadTooLarge is returned, wrapped with the sizes, by emits of a
+// message longer than Options.MaxPayload, and closes the connection when
+// the server sends one.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// frameBuffer holds the frames of a packet until they are all known to fit
+// in Options.MaxPayload.
+type frameBuffer struct {
+	frames []*bufferedFrame
+}
+
+type bufferedFrame struct {
+	bytes.Buffer
+	typ MessageType
+}
+
+func (f *bufferedFrame) Close() error {
+	return nil
+}
+
+func (b *frameBuffer) NextWriter(t MessageType) (io.WriteCloser, error) {
+	f := &bufferedFrame{typ: t}
+	b.frames = append(b.frames, f)
+	return f, nil
+}
+
+// flush writes the frames on w, or none of them when one is longer than
+// max bytes.
+func (b *frameBuffer) flush(w frameWriter, max int) error {
+	for _, f := range b.frames {
+		if f.Len() > max {
+			return fmt.Errorf("%w: %d bytes message, at most %d", ErrPayloadTooLarge, f.Len(), max)
+		}
+	}
+	for _, f := range b.frames {
+		fw, err := w.NextWriter(f.typ)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.Bytes()); err != nil {
+			fw.Close()
+			return err
+		}
+		if err := fw.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// preencoded is a JSON array of arguments encoded by the caller, written
+// after the event name as is, see EmitPreencoded.
+type preencoded []byte
+
+// MarshalJSON lets traces and samples see the arguments.
+func (p preencoded) MarshalJSON() ([]byte, error) {
+	return p, nil
+}
+
+// EmitPreencoded emits event with arguments the caller already encoded:
+// args is their JSON array, such as [1,"two"], spliced after the event name
+// without being decoded or checked beyond its brackets. ack, when not nil,
+// is the ack callback as the last argument of Emit.
+//
+// Being written as is, the arguments go through neither the codec of the
+// event, Options.Encrypt nor Options.Chunking.
+func (client *Client) EmitPreencoded(event string, args []byte, ack interface{}) error {
+	args = bytes.TrimSpace(args)
+	if len(args) < 2 || args[0] != '[' || args[len(args)-1] != ']' {
+		return fmt.Errorf("preencoded arguments of %q: not a JSON array", event)
+	}
+	data := []interface{}{preencoded(args)}
+	if ack != nil {
+		data = append(data, ack)
+	}
+	return client.emit(nil, client.opts.AckTimeout, event, data)
+}
+
+// preencodedArgs returns the preencoded arguments of data, an event name
+// followed by its arguments, and maybe by arguments outgoing middleware
+// added.
+func preencodedArgs(data interface{}) (preencoded, bool) {
+	args, ok := data.([]interface{})
+	if !ok || len(args) < 2 {
+		return nil, false
+	}
+	p, ok := args[1].(preencoded)
+	return p, ok
+}
+
+// marshalData returns the JSON array of the data of an event, preencoded
+// arguments flattened after the event name as on the wire.
+func marshalData(data interface{}) ([]byte, error) {
+	args, ok := preencodedArgs(data)
+	if !ok {
+		return json.Marshal(data)
+	}
+	var buf bytes.Buffer
+	if err := writePreencoded(&buf, data.([]interface{}), args); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writePreencoded writes data, the data array of an event with preencoded
+// arguments args.
+func writePreencoded(buf *bytes.Buffer, data []interface{}, args preencoded) error {
+	buf.WriteByte('[')
+	if err := writeJSON(buf, data[0]); err != nil {
+		return err
+	}
+	if inner := bytes.TrimSpace(args[1 : len(args)-1]); len(inner) > 0 {
+		buf.WriteByte(',')
+		buf.Write(inner)
+	}
+	for _, arg := range data[2:] {
+		buf.WriteByte(',')
+		if err := writeJSON(buf, arg); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// writeJSON writes the JSON of v without the newline of json.Encoder.
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(len(bytes.TrimRight(buf.Bytes(), "\n")))
+	return nil
+}
@@ -0,0 +1,99 @@
+package socketio_client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileOutboxPreencoded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+	o, err := OpenFileOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Push(Packet{Type: _EVENT, Id: -1, Data: []interface{}{"ev", preencoded(`[1, "two"]`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+
+	o, err = OpenFileOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	p, ok, err := o.Peek()
+	if err != nil || !ok {
+		t.Fatalf("Peek() = %v, %v", ok, err)
+	}
+	if got, want := string(p.Data.(json.RawMessage)), `["ev",1,"two"]`; got != want {
+		t.Fatalf("data = %s, want %s", got, want)
+	}
+}
+
+func TestMarshalPreencodedWithAddedArgs(t *testing.T) {
+	// as after an outgoing middleware appended an argument
+	data := []interface{}{"ev", preencoded(`[1, "two"]`), map[string]int{"three": 3}}
+	b, err := marshalData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `["ev",1, "two",{"three":3}]`; got != want {
+		t.Fatalf("data = %s, want %s", got, want)
+	}
+}
+
+// discardFrames is a frameWriter dropping what is written.
+type discardFrames struct{}
+
+func (discardFrames) NextWriter(MessageType) (io.WriteCloser, error) {
+	return nopCloser{ioutil.Discard}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type benchMessage struct {
+	Room string `json:"room"`
+	Text string `json:"text"`
+	Seq  int    `json:"seq"`
+}
+
+func benchmarkEncode(b *testing.B, data interface{}) {
+	e := newEncoder(discardFrames{}, nil, nil)
+	p := Packet{Type: _EVENT, NSP: "/chat", Id: 12, Data: data}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := e.Encode(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeEvent(b *testing.B) {
+	benchmarkEncode(b, []interface{}{"message", benchMessage{Room: "lobby", Text: "hello", Seq: 1}})
+}
+
+func BenchmarkEncodePreencoded(b *testing.B) {
+	benchmarkEncode(b, []interface{}{"message", preencoded(`[{"room":"lobby","text":"hello","seq":1}]`)})
+}
+
+func BenchmarkEncodeMaxPayload(b *testing.B) {
+	e := newEncoder(discardFrames{}, nil, nil)
+	e.max = 1 << 20
+	p := Packet{Type: _EVENT, Id: -1, Data: []interface{}{"message", benchMessage{Room: "lobby", Text: "hello", Seq: 1}}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := e.Encode(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package socketio_client
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrSkipHandlers is returned by a handler added with OnPriority to skip the
+// handlers of lower priority, without failing like other errors.
+var ErrSkipHandlers = errors.New("skip the remaining handlers")
+
+// OnPriority adds f to the handlers of event, next to the one registered
+// with On, which has priority 0. Handlers run by decreasing priority, those
+// of the same priority in the order they were registered, so that a
+// validation handler of priority 10 runs before the handler set with On:
+//
+//	client.OnPriority("order", 10, func(o Order) error {
+//		if o.Validate() != nil {
+//			return ErrSkipHandlers
+//		}
+//		return nil
+//	})
+//
+// A handler returning ErrSkipHandlers stops the handlers after it, as does
+// one panicking or returning another error, which is handled as the error
+// of any handler. The ack of the event carries the values returned by the
+// last handler run.
+func (client *Client) OnPriority(event string, priority int, f interface{}) error {
+	c, err := newCaller(f)
+	if err != nil {
+		return err
+	}
+	c.priority = priority
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	c.seq = client.nextSeqLocked()
+	handlers := append(client.priorities[event][:len(client.priorities[event]):len(client.priorities[event])], c)
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return handlers[i].priority > handlers[j].priority
+	})
+	client.priorities[event] = handlers
+	return nil
+}
+
+// nextSeqLocked numbers the handlers in the order they are registered.
+// client.eventsLock must be held.
+func (client *Client) nextSeqLocked() int {
+	client.handlerSeq++
+	return client.handlerSeq
+}
+
+// priorityHandlers returns the handlers of event added with OnPriority.
+func (client *Client) priorityHandlers(event string) []*caller {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	return client.priorities[event]
+}
+
+// prioritized returns c, which may be nil, among the handlers in extra, in
+// the order they run.
+func prioritized(c *caller, extra []*caller) []*caller {
+	if c == nil {
+		return extra
+	}
+	ret := make([]*caller, 0, len(extra)+1)
+	i := 0
+	for ; i < len(extra); i++ {
+		if h := extra[i]; h.priority < c.priority || (h.priority == c.priority && h.seq > c.seq) {
+			break
+		}
+		ret = append(ret, extra[i])
+	}
+	ret = append(ret, c)
+	return append(ret, extra[i:]...)
+}
@@ -0,0 +1,281 @@
+// Package promcollector exposes the activity of socket.io clients as
+// Prometheus metrics.
+//
+//	collector := promcollector.New()
+//	collector.AllowEvents("join", "message")
+//	prometheus.MustRegister(collector)
+//
+//	opts := &socketio_client.Options{}
+//	collector.Instrument(opts)
+//	client, err := socketio_client.NewClient(uri, opts)
+//	...
+//	collector.Watch(client)
+//
+// Ack and handler metrics are labeled with the event, which is OtherEvent
+// unless the event is given to AllowEvents or mapped by EventLabel, so that
+// dynamic or server-chosen event names cannot grow the number of series.
+package promcollector
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+const namespace = "socketio_client"
+
+// OtherEvent is the event label of the events neither allowed nor mapped.
+const OtherEvent = "other"
+
+var (
+	connectedDesc = prometheus.NewDesc(
+		namespace+"_connected",
+		"Number of watched clients whose connection is up.",
+		nil, nil,
+	)
+	disconnectedDesc = prometheus.NewDesc(
+		namespace+"_disconnected",
+		"Number of watched clients whose connection is down.",
+		nil, nil,
+	)
+	reconnectsDesc = prometheus.NewDesc(
+		namespace+"_reconnects_total",
+		"Number of times the connection of a watched client was re-established.",
+		nil, nil,
+	)
+)
+
+// Collector is a prometheus.Collector for socket.io clients. Options
+// passed to Instrument feed the packet, ack and handler metrics, clients
+// passed to Watch the connection ones.
+type Collector struct {
+	packets  *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	acks     *prometheus.HistogramVec
+	handlers *prometheus.HistogramVec
+
+	lock    sync.Mutex
+	clients map[*socketio_client.Client]struct{}
+	retired int                       //reconnects of clients no longer watched
+	label   func(event string) string //see EventLabel, nil for OtherEvent alone
+}
+
+func New() *Collector {
+	return &Collector{
+		packets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "packets_total",
+			Help:      "Number of socket.io packets sent and received.",
+		}, []string{"direction", "type"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_total",
+			Help:      "Number of socket.io packet bytes sent and received, attachments included.",
+		}, []string{"direction"}),
+		acks: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ack_duration_seconds",
+			Help:      "Time from an emit to its ack.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"namespace", "event", "result"}),
+		handlers: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in event handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"namespace", "event", "result"}),
+		clients: make(map[*socketio_client.Client]struct{}),
+	}
+}
+
+// Instrument hooks the collector into opts, keeping the Tracer,
+// TraceHandler and TraceEmit already set. Call it before NewClient.
+func (c *Collector) Instrument(opts *socketio_client.Options) {
+	if opts.Tracer != nil {
+		opts.Tracer = tracers{opts.Tracer, c}
+	} else {
+		opts.Tracer = c
+	}
+
+	traceHandler := opts.TraceHandler
+	opts.TraceHandler = func(info socketio_client.HandlerInfo) func(err error) {
+		var next func(err error)
+		if traceHandler != nil {
+			next = traceHandler(info)
+		}
+		start := time.Now()
+		return func(err error) {
+			c.handlers.WithLabelValues(info.Namespace, c.eventLabel(info.Event), result(err)).Observe(time.Since(start).Seconds())
+			if next != nil {
+				next(err)
+			}
+		}
+	}
+
+	traceEmit := opts.TraceEmit
+	opts.TraceEmit = func(info socketio_client.EmitInfo) func(err error) {
+		var next func(err error)
+		if traceEmit != nil {
+			next = traceEmit(info)
+		}
+		if !info.Ack {
+			return next
+		}
+		start := time.Now()
+		return func(err error) {
+			c.acks.WithLabelValues(info.Namespace, c.eventLabel(info.Event), result(err)).Observe(time.Since(start).Seconds())
+			if next != nil {
+				next(err)
+			}
+		}
+	}
+}
+
+// AllowEvents gives events a label of their own in the ack and handler
+// metrics, replacing the events allowed or the mapping set before.
+func (c *Collector) AllowEvents(events ...string) {
+	allowed := make(map[string]bool, len(events))
+	for _, event := range events {
+		allowed[event] = true
+	}
+	c.EventLabel(func(event string) string {
+		if allowed[event] {
+			return event
+		}
+		return OtherEvent
+	})
+}
+
+// EventLabel sets f to map an event to its label in the ack and handler
+// metrics, such as by stripping an id from it, replacing the events allowed
+// before. f must return few distinct labels; an empty one is OtherEvent.
+func (c *Collector) EventLabel(f func(event string) string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.label = f
+}
+
+func (c *Collector) eventLabel(event string) string {
+	c.lock.Lock()
+	f := c.label
+	c.lock.Unlock()
+	if f == nil {
+		return OtherEvent
+	}
+	if label := f(event); label != "" {
+		return label
+	}
+	return OtherEvent
+}
+
+// Watch adds client to the connection metrics.
+func (c *Collector) Watch(client *socketio_client.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.clients[client] = struct{}{}
+}
+
+// Forget removes client from the connection metrics, keeping its
+// reconnects in the total.
+func (c *Collector) Forget(client *socketio_client.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.clients[client]; ok {
+		delete(c.clients, client)
+		c.retired += client.Reconnects()
+	}
+}
+
+func (c *Collector) OnPacketSent(p socketio_client.WirePacket) {
+	c.observePacket("out", p)
+}
+
+func (c *Collector) OnPacketReceived(p socketio_client.WirePacket) {
+	c.observePacket("in", p)
+}
+
+func (c *Collector) observePacket(direction string, p socketio_client.WirePacket) {
+	c.packets.WithLabelValues(direction, packetType(p.Type)).Inc()
+	size := len(p.Payload)
+	for _, a := range p.Attachments {
+		size += len(a)
+	}
+	c.bytes.WithLabelValues(direction).Add(float64(size))
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectedDesc
+	ch <- disconnectedDesc
+	ch <- reconnectsDesc
+	c.packets.Describe(ch)
+	c.bytes.Describe(ch)
+	c.acks.Describe(ch)
+	c.handlers.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	connected, disconnected, reconnects := 0, 0, c.retired
+	for client := range c.clients {
+		if client.Connected() {
+			connected++
+		} else {
+			disconnected++
+		}
+		reconnects += client.Reconnects()
+	}
+	c.lock.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(connectedDesc, prometheus.GaugeValue, float64(connected))
+	ch <- prometheus.MustNewConstMetric(disconnectedDesc, prometheus.GaugeValue, float64(disconnected))
+	ch <- prometheus.MustNewConstMetric(reconnectsDesc, prometheus.CounterValue, float64(reconnects))
+	c.packets.Collect(ch)
+	c.bytes.Collect(ch)
+	c.acks.Collect(ch)
+	c.handlers.Collect(ch)
+}
+
+type tracers []socketio_client.Tracer
+
+func (t tracers) OnPacketSent(p socketio_client.WirePacket) {
+	for _, tracer := range t {
+		tracer.OnPacketSent(p)
+	}
+}
+
+func (t tracers) OnPacketReceived(p socketio_client.WirePacket) {
+	for _, tracer := range t {
+		tracer.OnPacketReceived(p)
+	}
+}
+
+func packetType(t socketio_client.PacketType) string {
+	switch t {
+	case socketio_client.PacketConnect:
+		return "connect"
+	case socketio_client.PacketDisconnect:
+		return "disconnect"
+	case socketio_client.PacketEvent:
+		return "event"
+	case socketio_client.PacketAck:
+		return "ack"
+	case socketio_client.PacketError:
+		return "error"
+	case socketio_client.PacketBinaryEvent:
+		return "binary_event"
+	case socketio_client.PacketBinaryAck:
+		return "binary_ack"
+	}
+	return strconv.Itoa(int(t))
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,79 @@
+package promcollector
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	socketio_client "github.com/h2570su/go-socket.io-client"
+)
+
+// eventLabels returns the event labels of the metric called name.
+func eventLabels(t *testing.T, c *Collector, name string) []string {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, f := range families {
+		if f.GetName() != namespace+"_"+name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "event" {
+					labels = append(labels, l.GetValue())
+				}
+			}
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// observe runs the handler and ack hooks of opts for each event.
+func observe(opts *socketio_client.Options, events ...string) {
+	for _, event := range events {
+		opts.TraceHandler(socketio_client.HandlerInfo{Namespace: "/", Event: event})(nil)
+		opts.TraceEmit(socketio_client.EmitInfo{Namespace: "/", Event: event, Ack: true})(errors.New("timeout"))
+	}
+}
+
+func TestEventLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *Collector)
+		want  []string
+	}{
+		{"default", func(c *Collector) {}, []string{OtherEvent}},
+		{"allowed", func(c *Collector) { c.AllowEvents("join") }, []string{"join", OtherEvent}},
+		{"mapped", func(c *Collector) {
+			c.EventLabel(func(event string) string {
+				if i := strings.IndexByte(event, ':'); i >= 0 {
+					return event[:i]
+				}
+				return ""
+			})
+		}, []string{OtherEvent, "user"}},
+	}
+	for _, tt := range tests {
+		c := New()
+		opts := &socketio_client.Options{}
+		c.Instrument(opts)
+		tt.setup(c)
+		observe(opts, "join", "user:1", "user:2", "leave")
+		for _, name := range []string{"handler_duration_seconds", "ack_duration_seconds"} {
+			if got := eventLabels(t, c, name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: %s event labels %q, want %q", tt.name, name, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package socketio_client
+
+import (
+	"net/url"
+	"strings"
+)
+
+// mergeQuery replaces the parameters of rawQuery named in values by those
+// values, keeping the order of every other parameter. Unlike
+// url.Values.Encode it does not reorder what the user passed in the uri.
+func mergeQuery(rawQuery string, values url.Values) string {
+	if len(values) == 0 {
+		return rawQuery
+	}
+	var parts []string
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p == "" {
+			continue
+		}
+		key := p
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			key = p[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			if _, replaced := values[k]; replaced {
+				continue
+			}
+		}
+		parts = append(parts, p)
+	}
+	if encoded := values.Encode(); encoded != "" {
+		parts = append(parts, encoded)
+	}
+	return strings.Join(parts, "&")
+}
+
+func setQuery(rawQuery, key, value string) string {
+	return mergeQuery(rawQuery, url.Values{key: {value}})
+}
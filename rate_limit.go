@@ -0,0 +1,265 @@
+package socketio_client
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrRateLimited is returned by emits over Options.EmitRateLimit when
+	// its policy is RateFail.
+	ErrRateLimited = errors.New("emit rate limited")
+	// ErrIncomingRateLimited closes the connection when events arrive over
+	// Options.IncomingRateLimit with the RateDisconnect overflow.
+	ErrIncomingRateLimited = errors.New("incoming events over the rate limit")
+)
+
+// RatePolicy decides what happens to an emit over Options.EmitRateLimit.
+type RatePolicy int
+
+const (
+	RateWait RatePolicy = iota //wait until the emit fits in the rate
+	RateFail                   //fail with ErrRateLimited
+)
+
+// RateLimit is a token bucket: Rate events a second on average, up to Burst
+// at once.
+type RateLimit struct {
+	Rate   float64    //events a second
+	Burst  int        //events sent at once after a quiet period, 1 by default
+	Policy RatePolicy //RateWait by default
+}
+
+// tokenBucket applies a RateLimit.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l *RateLimit) *tokenBucket {
+	if l == nil || l.Rate <= 0 {
+		return nil
+	}
+	return newBucket(l.Rate, l.Burst)
+}
+
+func newBucket(rate float64, burst int) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+// take takes a token, returning how long to wait for it to be there. When
+// wait is false it only takes a token already there, reporting whether it
+// did.
+func (b *tokenBucket) take(wait bool) (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	if b.tokens < 1 && !wait {
+		return 0, false
+	}
+	// waiting emits borrow from the tokens to come
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// next returns how long until a token is there.
+func (b *tokenBucket) next() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// limitEmit applies Options.EmitRateLimit to an emit.
+func (client *Client) limitEmit() error {
+	if client.emitBucket == nil {
+		return nil
+	}
+	delay, ok := client.emitBucket.take(client.opts.EmitRateLimit.Policy == RateWait)
+	if !ok {
+		return ErrRateLimited
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-client.manager.ctx.Done():
+		return ErrClosed
+	}
+}
+
+// RateOverflow decides what happens to an event arriving over
+// Options.IncomingRateLimit.
+type RateOverflow int
+
+const (
+	RateDrop       RateOverflow = iota //drop the event, counted in Stats.RateLimited
+	RateCoalesce                       //keep the latest event of each name, handled once the rate allows, dropping the ones it replaces
+	RateDisconnect                     //close the connection with ErrIncomingRateLimited
+)
+
+// IncomingRateLimit is a token bucket limiting the events from the server
+// reaching their handlers, Rate a second on average and up to Burst at
+// once. Acks are not limited. Events dropped or coalesced away are not
+// acknowledged.
+type IncomingRateLimit struct {
+	Rate     float64      //events a second
+	Burst    int          //events handled at once after a quiet period, 1 by default
+	PerEvent bool         //one bucket for each event name rather than one for all the events of the namespace
+	Overflow RateOverflow //RateDrop by default
+}
+
+// incomingLimiter applies Options.IncomingRateLimit to a client.
+type incomingLimiter struct {
+	limit *IncomingRateLimit
+
+	lock    sync.Mutex
+	buckets map[string]*tokenBucket //by event name, or "" for all
+	pending map[string]*pendingEvent
+}
+
+// pendingEvent is the latest event of a name coalesced under RateCoalesce.
+type pendingEvent struct {
+	decoder *decoder
+	packet  *Packet
+}
+
+func newIncomingLimiter(l *IncomingRateLimit) *incomingLimiter {
+	if l == nil || l.Rate <= 0 {
+		return nil
+	}
+	return &incomingLimiter{
+		limit:   l,
+		buckets: make(map[string]*tokenBucket),
+		pending: make(map[string]*pendingEvent),
+	}
+}
+
+func (l *incomingLimiter) bucket(event string) *tokenBucket {
+	key := ""
+	if l.limit.PerEvent {
+		key = event
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(l.limit.Rate, l.limit.Burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// limitIncoming applies Options.IncomingRateLimit to the event p, reporting
+// whether it is to be handled now.
+func (client *Client) limitIncoming(d *decoder, p *Packet) bool {
+	l := client.incomingLimit
+	if l == nil || (p.Type != _EVENT && p.Type != _BINARY_EVENT) {
+		return true
+	}
+	event := d.Message()
+	b := l.bucket(event)
+	coalesce := l.limit.Overflow == RateCoalesce
+	if coalesce {
+		l.lock.Lock()
+		prev, waiting := l.pending[event]
+		if waiting {
+			// replaced by the later event, which keeps its place
+			l.pending[event] = &pendingEvent{decoder: d, packet: p}
+		}
+		l.lock.Unlock()
+		if waiting {
+			atomic.AddUint64(&client.stats.rateLimited, 1)
+			prev.decoder.Close()
+			return false
+		}
+	}
+	if _, ok := b.take(false); ok {
+		return true
+	}
+	switch {
+	case coalesce:
+		l.lock.Lock()
+		l.pending[event] = &pendingEvent{decoder: d, packet: p}
+		l.lock.Unlock()
+		client.afterPending(event, b)
+		return false
+	case l.limit.Overflow == RateDisconnect:
+		client.manager.log.Errorf("socket.io %s: events over the rate limit, closing", client.manager.url)
+		if conn, _ := client.manager.connection(); conn != nil {
+			conn.shutdown(false, ErrIncomingRateLimited)
+		}
+	}
+	atomic.AddUint64(&client.stats.rateLimited, 1)
+	d.Close()
+	return false
+}
+
+// afterPending calls handlePending once b has a token again.
+func (client *Client) afterPending(event string, b *tokenBucket) {
+	time.AfterFunc(b.next(), labeled(client.opts, func() {
+		client.handlePending(event, b)
+	}, "rateLimit", "socketio.namespace", client.Namespace()))
+}
+
+// handlePending handles the latest event coalesced under the name event
+// once b has a token for it.
+func (client *Client) handlePending(event string, b *tokenBucket) {
+	if _, ok := b.take(false); !ok {
+		client.afterPending(event, b)
+		return
+	}
+	l := client.incomingLimit
+	l.lock.Lock()
+	e := l.pending[event]
+	delete(l.pending, event)
+	l.lock.Unlock()
+	if e == nil {
+		return
+	}
+	// handled as if just read, through the middleware and Options.Dispatch,
+	// one at a time with the read loop in DispatchSerial mode
+	key := e.packet.NSP + "\x00" + event
+	handled := client.manager.dispatcher.run(key, func() {
+		if err := client.handleIncoming(e.decoder, e.packet); err != nil {
+			client.manager.log.Errorf("socket.io %s: handling %s: %v", client.manager.url, event, err)
+		}
+	})
+	if !handled {
+		e.decoder.Close()
+	}
+}
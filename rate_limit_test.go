@@ -0,0 +1,116 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescedEventsThroughMiddleware(t *testing.T) {
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		if !bytes.HasPrefix(f.Data, []byte(`42["start"`)) {
+			return false
+		}
+		for _, tick := range []string{"1", "2", "3"} {
+			conn.WriteFrame(MemoryFrame{Data: []byte(`42["tick",` + tick + `]`)})
+		}
+		return true
+	})
+	opts := memoryOptions()
+	opts.IncomingRateLimit = &IncomingRateLimit{Rate: 20, Overflow: RateCoalesce}
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var (
+		lock sync.Mutex
+		seen []string
+	)
+	client.UseIncoming(func(pkt *Packet, next func()) {
+		if args, ok := pkt.Data.([]json.RawMessage); ok && string(args[0]) == `"tick"` {
+			lock.Lock()
+			seen = append(seen, string(args[1]))
+			lock.Unlock()
+		}
+		next()
+	})
+	ticks := make(chan int, 3)
+	client.On("tick", func(tick int) {
+		ticks <- tick
+	})
+	client.Emit("start")
+
+	var got []int
+	for len(got) < 2 {
+		select {
+		case tick := <-ticks:
+			got = append(got, tick)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got ticks %v, want [1 3]", got)
+		}
+	}
+	if got[0] != 1 || got[1] != 3 {
+		t.Fatalf("got ticks %v, want [1 3]", got)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(seen) != 2 || seen[1] != "3" {
+		t.Fatalf("middleware saw ticks %v, want [1 3]", seen)
+	}
+}
+
+func TestCoalescedEventsDispatchedSerially(t *testing.T) {
+	uri := newMemoryServer(t, func(conn *MemoryConn, f MemoryFrame) bool {
+		if !bytes.HasPrefix(f.Data, []byte(`42["start"`)) {
+			return false
+		}
+		// the second tick waits for a token while busy runs
+		for _, frame := range []string{`42["tick",1]`, `42["tick",2]`, `42["busy"]`} {
+			conn.WriteFrame(MemoryFrame{Data: []byte(frame)})
+		}
+		return true
+	})
+	opts := memoryOptions()
+	opts.Dispatch = DispatchSerial
+	opts.IncomingRateLimit = &IncomingRateLimit{Rate: 20, PerEvent: true, Overflow: RateCoalesce}
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var running, overlaps int32
+	enter := func() {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+	}
+	done := make(chan int, 2)
+	client.On("tick", func(tick int) {
+		enter()
+		defer atomic.AddInt32(&running, -1)
+		if tick == 2 {
+			done <- tick
+		}
+	})
+	client.On("busy", func() {
+		enter()
+		defer atomic.AddInt32(&running, -1)
+		time.Sleep(200 * time.Millisecond)
+	})
+	client.Emit("start")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the coalesced tick was not handled")
+	}
+	if n := atomic.LoadInt32(&overlaps); n > 0 {
+		t.Errorf("%d handlers ran next to another in DispatchSerial mode", n)
+	}
+}
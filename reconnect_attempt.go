@@ -0,0 +1,61 @@
+package socketio_client
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ReconnectAttempt is passed to Options.OnReconnectAttempt before each
+// reconnect attempt. Its changes apply to that attempt only, the next one
+// starting again from the Options.
+type ReconnectAttempt struct {
+	Attempt int         //from 1
+	URL     string      //server to try instead of the uri of NewClient and Options.FallbackURLs when set
+	Header  http.Header //headers of the requests, a copy of Options.Header, such as an Authorization or a CSRF token
+	Query   url.Values  //query parameters added to those of the urls, overriding the same keys, such as a fresh token
+}
+
+// attemptOptions returns the options and the endpoints of the reconnect
+// attempt, as changed by Options.OnReconnectAttempt.
+func (m *manager) attemptOptions(attempt int) (*Options, *endpoints, error) {
+	if m.opts.OnReconnectAttempt == nil {
+		return m.opts, m.endpoints, nil
+	}
+	a := &ReconnectAttempt{
+		Attempt: attempt,
+		Header:  http.Header(m.opts.Header).Clone(),
+		Query:   url.Values{},
+	}
+	if a.Header == nil {
+		a.Header = make(http.Header)
+	}
+	if err := m.opts.OnReconnectAttempt(a); err != nil {
+		return nil, nil, err
+	}
+
+	opts := *m.opts
+	opts.Header = a.Header
+	if len(a.Query) > 0 {
+		queryFunc := m.opts.QueryFunc
+		opts.QueryFunc = func() url.Values {
+			values := url.Values{}
+			if queryFunc != nil {
+				for k, v := range queryFunc() {
+					values[k] = v
+				}
+			}
+			for k, v := range a.Query {
+				values[k] = v
+			}
+			return values
+		}
+	}
+	if a.URL == "" {
+		return &opts, m.endpoints, nil
+	}
+	u, err := socketURL(a.URL, &opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &opts, newEndpoints([]*url.URL{u}, opts.FallbackPolicy), nil
+}
@@ -0,0 +1,187 @@
+package socketio_client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+	"github.com/zhouhui8915/engine.io-go/transport"
+)
+
+// Record is an engine.io packet of a recording, as written by a Recorder
+// on one JSON line. Text packets start with their type as a digit, such as
+// "42[\"chat\",\"hi\"]"; binary ones with their type as a byte, 4 for a
+// message.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Sent      bool      `json:"sent,omitempty"` //by the client
+	Transport string    `json:"transport,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Binary    []byte    `json:"binary,omitempty"`
+}
+
+// Recorder writes every engine.io packet sent or received by the clients
+// it is set as Options.Record of, pings and handshakes included, so the
+// session can be replayed with a Replayer:
+//
+//	f, err := os.Create("session.jsonl")
+//	...
+//	opts := &socketio_client.Options{
+//		Record: socketio_client.NewRecorder(f),
+//	}
+type Recorder struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+	err  error
+}
+
+// NewRecorder returns a Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the error that stopped the recording, if any.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(rec Record) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(rec)
+	}
+}
+
+// ReadRecords returns the records written by a Recorder to r.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var ret []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		ret = append(ret, rec)
+	}
+	return ret, scanner.Err()
+}
+
+// frame returns the packet of rec as the memory transport carries it.
+func (rec Record) frame() MemoryFrame {
+	if rec.Binary != nil {
+		return MemoryFrame{Binary: true, Data: rec.Binary}
+	}
+	return MemoryFrame{Data: []byte(rec.Text)}
+}
+
+// newRecord returns the record of the packet of type t carrying data.
+func newRecord(sent bool, name string, msgType message.MessageType, t parser.PacketType, data []byte) Record {
+	rec := Record{Time: time.Now(), Sent: sent, Transport: name}
+	if msgType == message.MessageBinary {
+		rec.Binary = append([]byte{t.Byte()}, data...)
+	} else {
+		rec.Text = string(t.Byte()+'0') + string(data)
+	}
+	return rec
+}
+
+// recorded wraps t, the transport called name, so its packets go to
+// Options.Record.
+func (c *clientConn) recorded(name string, t transport.Client) transport.Client {
+	if c.options.Record == nil {
+		return t
+	}
+	return &recordedClient{Client: t, name: name, recorder: c.options.Record}
+}
+
+type recordedClient struct {
+	transport.Client
+	name     string
+	recorder *Recorder
+}
+
+func (c *recordedClient) setSession(sid string) {
+	if s, ok := c.Client.(sessionSetter); ok {
+		s.setSession(sid)
+	}
+}
+
+func (c *recordedClient) Flush() error {
+	if f, ok := c.Client.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (c *recordedClient) NextReader() (*parser.PacketDecoder, error) {
+	pack, err := c.Client.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readAll(pack)
+	pack.Close()
+	if err != nil {
+		return nil, err
+	}
+	rec := newRecord(false, c.name, pack.MessageType(), pack.Type(), data)
+	c.recorder.record(rec)
+	// handed on as a packet of the memory transport
+	return parser.NewDecoder(bytes.NewReader(rec.frame().Data))
+}
+
+func (c *recordedClient) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	w, err := c.Client.NextWriter(msgType, packetType)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedWriter{WriteCloser: w, client: c, msgType: msgType, packetType: packetType}, nil
+}
+
+// recordedWriter records what was written once closed.
+type recordedWriter struct {
+	io.WriteCloser
+	client     *recordedClient
+	msgType    message.MessageType
+	packetType parser.PacketType
+	buf        bytes.Buffer
+}
+
+func (w *recordedWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.buf.Write(p[:n])
+	return n, err
+}
+
+func (w *recordedWriter) Close() error {
+	wait, err := w.closeWait()
+	if err != nil {
+		return err
+	}
+	return wait()
+}
+
+func (w *recordedWriter) closeWait() (func() error, error) {
+	wait, err := noWait, error(nil)
+	if wc, ok := w.WriteCloser.(waitCloser); ok {
+		wait, err = wc.closeWait()
+	} else {
+		err = w.WriteCloser.Close()
+	}
+	if err == nil {
+		c := w.client
+		c.recorder.record(newRecord(true, c.name, w.msgType, w.packetType, w.buf.Bytes()))
+	}
+	return wait, err
+}
@@ -0,0 +1,56 @@
+package socketio_client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// RedirectPolicy tells which 3xx responses to the polling requests, the
+// handshake included, are followed. A redirect that is not followed fails
+// the request, with a HandshakeError holding the response on the handshake.
+type RedirectPolicy int
+
+const (
+	RedirectFollow     RedirectPolicy = iota //follow up to 10 redirects to any server, as net/http does
+	RedirectSameOrigin                       //follow redirects to the same scheme and host only
+	RedirectNever                            //follow no redirect
+)
+
+// checkRedirect returns the http.Client CheckRedirect of policy.
+func checkRedirect(policy RedirectPolicy) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		switch {
+		case policy == RedirectNever:
+			return http.ErrUseLastResponse
+		case policy == RedirectSameOrigin && !sameOrigin(req.URL, via[0].URL):
+			return http.ErrUseLastResponse
+		case len(via) >= 10:
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return a.Scheme == b.Scheme && a.Host == b.Host
+}
+
+// movedURL returns the url resp was finally got from when the server
+// permanently moved, every redirect being a 301 or a 308, nil otherwise.
+func movedURL(resp *http.Response) *url.URL {
+	if resp == nil || resp.Request == nil || resp.Request.Response == nil {
+		return nil
+	}
+	for r := resp.Request; r.Response != nil; r = r.Response.Request {
+		if s := r.Response.StatusCode; s != http.StatusMovedPermanently && s != http.StatusPermanentRedirect {
+			return nil
+		}
+	}
+	return resp.Request.URL
+}
+
+// moveTo points u at the scheme, host and path of moved, keeping its query.
+func moveTo(u *url.URL, moved *url.URL) {
+	u.Scheme, u.Host, u.Path, u.RawPath = moved.Scheme, moved.Host, moved.Path, moved.RawPath
+}
@@ -0,0 +1,201 @@
+package socketio_client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhouhui8915/engine.io-go/parser"
+)
+
+var replays int64
+
+// Replayer plays the server side of a recording back to a client, through
+// the "memory" transport, to reproduce a session deterministically:
+//
+//	records, err := socketio_client.ReadRecords(f)
+//	...
+//	replay, err := socketio_client.NewReplayer(records)
+//	...
+//	defer replay.Close()
+//	client, err := socketio_client.NewClient(replay.URL(), &socketio_client.Options{
+//		Transport: []string{"memory"},
+//	})
+//
+// The packets received by the recorded client are sent in order, each
+// waiting for the client to have sent the packets it had sent before it.
+// Pings are answered as they come rather than replayed, and upgrades are
+// left out. Each engine.io handshake of the recording starts a session
+// replayed on a connection of its own, the one before being closed, so the
+// client needs Options.Reconnection to replay them all.
+type Replayer struct {
+	Realtime bool //waits between packets as long as when recorded, instead of sending them as soon as their turn comes
+
+	sessions [][]Record
+	listener *MemoryListener
+	done     chan struct{}
+	err      error
+	lock     sync.Mutex
+	conn     *MemoryConn
+}
+
+// NewReplayer returns a Replayer of records, listening for a client on its
+// URL.
+func NewReplayer(records []Record) (*Replayer, error) {
+	var sessions [][]Record
+	for _, rec := range records {
+		if sessions == nil || !rec.Sent && frameType(rec.frame()) == parser.OPEN {
+			sessions = append(sessions, nil)
+		}
+		sessions[len(sessions)-1] = append(sessions[len(sessions)-1], rec)
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("replay: no record")
+	}
+	l, err := ListenMemory(fmt.Sprintf("replay-%d", atomic.AddInt64(&replays, 1)))
+	if err != nil {
+		return nil, err
+	}
+	p := &Replayer{
+		sessions: sessions,
+		listener: l,
+		done:     make(chan struct{}),
+	}
+	go p.serve()
+	return p, nil
+}
+
+// URL returns the uri to hand to NewClient.
+func (p *Replayer) URL() string {
+	return "memory://" + p.listener.name
+}
+
+// Done is closed once the whole recording was replayed and the client
+// closed the last connection, or the Replayer was closed.
+func (p *Replayer) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns why the replay stopped short, once Done is closed.
+func (p *Replayer) Err() error {
+	<-p.done
+	return p.err
+}
+
+// Close stops the replay and closes the connection of the client.
+func (p *Replayer) Close() error {
+	p.listener.Close()
+	p.lock.Lock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *Replayer) serve() {
+	defer close(p.done)
+	defer p.listener.Close()
+	for i, session := range p.sessions {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			p.err = fmt.Errorf("replay: session %d: %w", i, err)
+			return
+		}
+		p.lock.Lock()
+		p.conn = conn
+		p.lock.Unlock()
+		if err := p.replay(conn, session, i == len(p.sessions)-1); err != nil {
+			p.err = fmt.Errorf("replay: session %d: %w", i, err)
+			return
+		}
+	}
+}
+
+// replay plays session on conn, then closes it unless last, in which case
+// it waits for the client to close it.
+func (p *Replayer) replay(conn *MemoryConn, session []Record, last bool) error {
+	// packets the client sent so far, pings aside
+	var sent int64
+	notify := make(chan struct{}, 1)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			f, err := conn.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch frameType(f) {
+			case parser.PING:
+				pong := MemoryFrame{Binary: f.Binary, Data: append([]byte{f.Data[0] + 1}, f.Data[1:]...)}
+				if conn.WriteFrame(pong) != nil {
+					return
+				}
+			case parser.PONG, parser.UPGRADE, parser.NOOP:
+			case parser.CLOSE:
+				conn.Close()
+				return
+			default:
+				atomic.AddInt64(&sent, 1)
+				select {
+				case notify <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	start, first := time.Now(), session[0].Time
+	var want int64
+	for _, rec := range session {
+		switch frameType(rec.frame()) {
+		case parser.PING, parser.PONG, parser.UPGRADE, parser.NOOP:
+			continue
+		case parser.CLOSE:
+			if rec.Sent {
+				// the client ended the recorded session
+				<-closed
+				return nil
+			}
+		}
+		if rec.Sent {
+			want++
+			for atomic.LoadInt64(&sent) < want {
+				select {
+				case <-notify:
+				case <-closed:
+					return ErrMemoryClosed
+				}
+			}
+			continue
+		}
+		if p.Realtime {
+			time.Sleep(time.Until(start.Add(rec.Time.Sub(first))))
+		}
+		if err := conn.WriteFrame(rec.frame()); err != nil {
+			return err
+		}
+	}
+	if last {
+		<-closed
+		return nil
+	}
+	return conn.Close()
+}
+
+// frameType returns the engine.io type of the packet f, NOOP when it has
+// none.
+func frameType(f MemoryFrame) parser.PacketType {
+	if len(f.Data) == 0 {
+		return parser.NOOP
+	}
+	b := f.Data[0]
+	if !f.Binary {
+		b -= '0'
+	}
+	t, _ := parser.ByteToType(b)
+	return t
+}
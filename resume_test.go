@@ -0,0 +1,109 @@
+package socketio_client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+)
+
+// scriptedTransport answers reads with its frames, in the format of
+// MemoryFrame, then blocks until closed. It returns err instead when set.
+type scriptedTransport struct {
+	frames [][]byte
+	err    error
+	closed chan struct{}
+	sent   []parser.PacketType
+}
+
+func newScriptedTransport(frames ...string) *scriptedTransport {
+	t := &scriptedTransport{closed: make(chan struct{})}
+	for _, f := range frames {
+		t.frames = append(t.frames, []byte(f))
+	}
+	return t
+}
+
+func (t *scriptedTransport) Response() *http.Response {
+	return nil
+}
+
+func (t *scriptedTransport) NextReader() (*parser.PacketDecoder, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if len(t.frames) == 0 {
+		<-t.closed
+		return nil, io.EOF
+	}
+	f := t.frames[0]
+	t.frames = t.frames[1:]
+	return parser.NewDecoder(bytes.NewReader(f))
+}
+
+func (t *scriptedTransport) NextWriter(_ message.MessageType, pt parser.PacketType) (io.WriteCloser, error) {
+	t.sent = append(t.sent, pt)
+	return nopCloser{ioutil.Discard}, nil
+}
+
+func (t *scriptedTransport) Close() error {
+	select {
+	case <-t.closed:
+	default:
+		close(t.closed)
+	}
+	return nil
+}
+
+func resumingConn(t *scriptedTransport) *clientConn {
+	prev := &clientConn{id: "sid", pingInterval: time.Minute, pingTimeout: 100 * time.Millisecond}
+	c := &clientConn{options: &Options{}, log: optionsLogger(&Options{}), resume: prev}
+	c.setCurrent("polling", t)
+	return c
+}
+
+func TestResumeSessionWaitsForPong(t *testing.T) {
+	tr := newScriptedTransport(`4held`, `3`)
+	c := resumingConn(tr)
+	if err := c.resumeSession(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.resumed || c.id != "sid" {
+		t.Errorf("resumed %v, id %q", c.resumed, c.id)
+	}
+	if len(tr.sent) != 1 || tr.sent[0] != parser.PING {
+		t.Errorf("sent %v, want a ping", tr.sent)
+	}
+	if len(c.early) != 1 || string(c.early[0]) != "4held" {
+		t.Errorf("early %q, want the message read before the pong", c.early)
+	}
+}
+
+func TestResumeSessionWithoutPong(t *testing.T) {
+	tests := []struct {
+		name string
+		tr   *scriptedTransport
+	}{
+		{"silent", newScriptedTransport()},
+		{"message only", newScriptedTransport(`4held`)},
+		{"closed", newScriptedTransport(`1`)},
+		{"refused", &scriptedTransport{err: errors.New("400 Bad Request"), closed: make(chan struct{})}},
+	}
+	for _, tt := range tests {
+		c := resumingConn(tt.tr)
+		start := time.Now()
+		err := c.resumeSession()
+		if err == nil || c.resumed {
+			t.Errorf("%s: resumed %v, error %v", tt.name, c.resumed, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: gave up after %v, want the ping timeout", tt.name, d)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// ErrRetriesExhausted is passed to an ack callback taking an error as its
+// last argument when no ack arrived within the retry budget.
+var ErrRetriesExhausted = errors.New("no ack after all retries")
+
+// ErrAckTimeout is passed to an ack callback taking an error as its last
+// argument when no ack arrived within the ack timeout.
+var ErrAckTimeout = errors.New("ack timeout")
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RetryPolicy makes emits with an ack callback at-least-once: the event is
+// sent again until it is acknowledged or the retries are used up. Every
+// retry reuses the ack id of the first attempt, so servers can use it as
+// an idempotency key. Events with attachments are not retried.
+type RetryPolicy struct {
+	Retries int           //retries after the first attempt
+	Timeout time.Duration //how long to wait for the ack before retrying, 5s by default
+}
+
+func (p *RetryPolicy) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return p.Timeout
+}
+
+func (client *Client) retry(ctx context.Context, id int, args []interface{}, policy *RetryPolicy) {
+	setGoroutineLabels(client.opts, "retry", "socketio.namespace", client.Namespace())
+	timer := time.NewTimer(policy.timeout())
+	defer timer.Stop()
+	for attempt := 0; ; attempt++ {
+		<-timer.C
+
+		client.acksLock.Lock()
+		c, pending := client.acks[id]
+		if pending && attempt >= policy.Retries {
+			delete(client.acks, id)
+		}
+		client.acksLock.Unlock()
+		if !pending {
+			return
+		}
+		if attempt >= policy.Retries {
+			client.failAck(c, ErrRetriesExhausted)
+			return
+		}
+
+		client.sendPacket(Packet{
+			Type: _EVENT,
+			Id:   id,
+			NSP:  client.namespace,
+			Data: args,
+			ctx:  ctx,
+		})
+		timer.Reset(policy.timeout())
+	}
+}
+
+// expireAck drops the ack callback c waiting for id, failing it with
+// ErrAckTimeout unless the ack arrived meanwhile.
+func (client *Client) expireAck(id int, c *caller) {
+	client.acksLock.Lock()
+	pending := client.acks[id] == c
+	if pending {
+		delete(client.acks, id)
+	}
+	client.acksLock.Unlock()
+	if pending {
+		client.failAck(c, ErrAckTimeout)
+	}
+}
+
+// failAcks fails every ack callback still waiting with err, as no ack can
+// arrive anymore.
+func (client *Client) failAcks(err error) {
+	client.acksLock.Lock()
+	acks := client.acks
+	client.acks = make(map[int]*caller)
+	client.acksLock.Unlock()
+	for _, c := range acks {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		client.failAck(c, err)
+	}
+}
+
+// failAck calls the ack callback c with err when its last argument is an
+// error, the other arguments being zero values.
+func (client *Client) failAck(c *caller, err error) {
+	if c.end != nil {
+		c.end(err)
+	}
+	last := len(c.Args) - 1
+	if last < 0 || !c.Args[last].Implements(errorType) {
+		return
+	}
+	args := c.GetArgs(0)
+	args[last] = &err
+	client.invoke(nil, "ack", c, args)
+}
+
+// failLostAcks fails with err the ack callbacks waiting for an ack on the
+// connection that was lost, but those whose events are retried, which the
+// next connection may acknowledge.
+func (client *Client) failLostAcks(err error) {
+	client.acksLock.Lock()
+	var lost []*caller
+	for id, c := range client.acks {
+		if !c.retried {
+			delete(client.acks, id)
+			lost = append(lost, c)
+		}
+	}
+	client.acksLock.Unlock()
+	for _, c := range lost {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		client.failAck(c, err)
+	}
+}
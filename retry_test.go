@@ -0,0 +1,129 @@
+package socketio_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAckCalledOnce(t *testing.T) {
+	client := &Client{opts: &Options{}, acks: make(map[int]*caller)}
+	for id := 0; id < 1000; id++ {
+		var calls int32
+		c, err := newCaller(func(s string, err error) {
+			atomic.AddInt32(&calls, 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.acks[id] = c
+
+		var wg sync.WaitGroup
+		wg.Add(5)
+		for i := 0; i < 4; i++ {
+			go func() {
+				defer wg.Done()
+				d := &decoder{args: []json.RawMessage{json.RawMessage(`"ok"`)}}
+				client.onAck(id, d, &Packet{Type: _ACK, Id: id})
+			}()
+		}
+		go func() {
+			defer wg.Done()
+			client.expireAck(id, c)
+		}()
+		wg.Wait()
+		if calls != 1 {
+			t.Fatalf("ack %d: callback called %d times, want 1", id, calls)
+		}
+	}
+}
+
+func TestAckNotRegisteredWhenSendFails(t *testing.T) {
+	uri := newMemoryServer(t, nil)
+	opts := memoryOptions()
+	opts.MaxPayload = 64
+	opts.AckTimeout = time.Minute
+	client, err := NewClient(uri, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	err = client.Emit("big", strings.Repeat("x", 100), func(s string) {})
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("Emit() error = %v, want ErrPayloadTooLarge", err)
+	}
+	client.acksLock.Lock()
+	defer client.acksLock.Unlock()
+	if len(client.acks) != 0 {
+		t.Errorf("%d acks waiting for a packet never sent", len(client.acks))
+	}
+}
+
+// dropOnEvent serves one connection, closing it and the listener once an
+// event arrives, so that reconnecting fails.
+func dropOnEvent(t *testing.T) string {
+	l, err := ListenMemory(fmt.Sprintf("drop-%d", atomic.AddInt64(&memoryServers, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveMemory(conn, func(conn *MemoryConn, f MemoryFrame) bool {
+			if strings.HasPrefix(string(f.Data), "42") {
+				l.Close()
+				conn.Close()
+				return true
+			}
+			return false
+		})
+	}()
+	return "memory://" + l.name
+}
+
+func TestAcksFailedWithTheConnection(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry *RetryPolicy
+		want  error
+	}{
+		// failed as the connection is lost
+		{"lost", nil, ErrClosed},
+		// retried until reconnecting is given up
+		{"given up", &RetryPolicy{Retries: 5, Timeout: time.Minute}, ErrReconnectFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := memoryOptions()
+			opts.Reconnection = true
+			opts.ReconnectionAttempts = 2
+			opts.ReconnectionDelay = 10 * time.Millisecond
+			opts.Retry = tt.retry
+			client, err := NewClient(dropOnEvent(t), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			failed := make(chan error, 1)
+			if err := client.Emit("ask", func(s string, err error) { failed <- err }); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-failed:
+				if !errors.Is(err, tt.want) {
+					t.Errorf("ack failed with %v, want %v", err, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the ack callback was never called")
+			}
+		})
+	}
+}
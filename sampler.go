@@ -0,0 +1,98 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// Sample is an event payload picked by a Sampler.
+type Sample struct {
+	Event     string
+	Namespace string
+	Outgoing  bool
+	Payload   []byte //JSON array of the event arguments
+}
+
+// Sampler passes one in every N payloads of each event to OnSample, for
+// looking at real payload shapes without capturing all traffic. A Sampler
+// may be shared by many clients.
+type Sampler struct {
+	Rate     int            //sample 1 in Rate payloads of every event, 0 disables
+	Rates    map[string]int //per event rates overriding Rate
+	OnSample func(s Sample)
+
+	lock   sync.Mutex
+	counts map[sampleKey]uint64
+}
+
+type sampleKey struct {
+	event    string
+	outgoing bool
+}
+
+func (s *Sampler) sample(event string, outgoing bool) bool {
+	if s == nil || s.OnSample == nil {
+		return false
+	}
+	rate := s.Rate
+	if r, ok := s.Rates[event]; ok {
+		rate = r
+	}
+	if rate <= 0 {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[sampleKey]uint64)
+	}
+	key := sampleKey{event, outgoing}
+	n := s.counts[key]
+	s.counts[key] = n + 1
+	return n%uint64(rate) == 0
+}
+
+func (client *Client) sampleOutgoing(p *Packet) {
+	args, ok := p.Data.([]interface{})
+	if !ok || len(args) == 0 {
+		return
+	}
+	event, _ := args[0].(string)
+	if !client.opts.Sampler.sample(event, true) {
+		return
+	}
+	payload, err := json.Marshal(args[1:])
+	if pre, ok := preencodedArgs(args); ok {
+		payload, err = pre, nil
+	}
+	if err != nil {
+		return
+	}
+	client.opts.Sampler.OnSample(Sample{
+		Event:     event,
+		Namespace: client.Namespace(),
+		Outgoing:  true,
+		Payload:   payload,
+	})
+}
+
+func (client *Client) sampleIncoming(decoder *decoder) {
+	event := decoder.Message()
+	if !client.opts.Sampler.sample(event, false) {
+		return
+	}
+	client.opts.Sampler.OnSample(Sample{
+		Event:     event,
+		Namespace: client.Namespace(),
+		Payload:   append(append([]byte{'['}, bytes.Join(rawBytes(decoder.args), []byte{','})...), ']'),
+	})
+}
+
+func rawBytes(raw []json.RawMessage) [][]byte {
+	ret := make([][]byte, len(raw))
+	for i, r := range raw {
+		ret[i] = r
+	}
+	return ret
+}
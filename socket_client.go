@@ -0,0 +1,19 @@
+package socketio_client
+
+import "time"
+
+// SocketClient is what applications use of a Client to talk to a server,
+// so their socket logic can be tested against a fake such as
+// mockclient.Client.
+type SocketClient interface {
+	On(event string, f interface{}) error
+	Emit(event string, args ...interface{}) error
+	EmitTimeout(timeout time.Duration, event string, args ...interface{}) error
+	Namespace() string
+	Connected() bool
+	Done() <-chan struct{}
+	Err() error
+	Close() error
+}
+
+var _ SocketClient = (*Client)(nil)
@@ -0,0 +1,348 @@
+// Package sockettest runs a minimal socket.io server in the test process, to
+// test code using socketio_client against a real connection without a
+// Node.js server. It accepts namespace connects, echoes every event back to
+// its sender, binary attachments included, and acknowledges events sent
+// with an ack callback, with their own arguments or scripted ones.
+//
+//	srv := sockettest.NewServer()
+//	defer srv.Close()
+//	srv.Ack("join", "ok")
+//	client, err := socketio_client.NewClient(srv.URL, nil)
+//	...
+//	if events := srv.Events(); len(events) != 1 || events[0].Name != "join" {
+//		t.Fatal(events)
+//	}
+package sockettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"sync"
+
+	engineio "github.com/zhouhui8915/engine.io-go"
+
+	"github.com/h2570su/go-socket.io-client/packet"
+)
+
+// Event is an event received by the server.
+type Event struct {
+	Namespace   string // "/" for the default one
+	Name        string
+	Args        []json.RawMessage // binary arguments are left as placeholders
+	Attachments [][]byte
+}
+
+type Server struct {
+	URL string // base uri of the server, to hand to socketio_client.NewClient
+
+	engine *engineio.Server
+	http   *httptest.Server
+
+	lock    sync.Mutex
+	acks    map[string][]interface{}
+	rejects map[string]interface{}
+	events  []Event
+	sockets map[*socket]bool
+}
+
+type socket struct {
+	conn  engineio.Conn
+	wlock sync.Mutex // serializes writes
+	lock  sync.Mutex
+	nsps  map[string]bool
+}
+
+// NewServer starts a server on a loopback port, panicking when it cannot,
+// as httptest.NewServer does. Close stops it.
+func NewServer() *Server {
+	engine, err := engineio.NewServer(nil)
+	if err != nil {
+		panic(fmt.Sprintf("sockettest: %v", err))
+	}
+	s := &Server{
+		engine:  engine,
+		http:    httptest.NewUnstartedServer(engine),
+		acks:    make(map[string][]interface{}),
+		rejects: make(map[string]interface{}),
+		sockets: make(map[*socket]bool),
+	}
+	// engine.io-go writes a header on hijacked websocket connections,
+	// which net/http would log on every upgrade
+	s.http.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	s.http.Start()
+	s.URL = s.http.URL
+	go s.accept()
+	return s
+}
+
+// Close disconnects all the clients and stops the server.
+func (s *Server) Close() {
+	s.lock.Lock()
+	sockets := s.sockets
+	s.sockets = make(map[*socket]bool)
+	s.lock.Unlock()
+	for so := range sockets {
+		so.conn.Close()
+	}
+	// long polling requests would hold Close until the next ping
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
+
+// Ack makes the server acknowledge event with args rather than with the
+// arguments of the event.
+func (s *Server) Ack(event string, args ...interface{}) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.acks[event] = args
+}
+
+// Reject makes the server refuse connects to the namespace nsp with an
+// error packet carrying data, which fails NewClient with
+// ErrNamespaceRefused, or fires the "error" handler of a client connecting
+// again. A nil data accepts them again.
+func (s *Server) Reject(nsp string, data interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if data == nil {
+		delete(s.rejects, namespace(nsp))
+		return
+	}
+	s.rejects[namespace(nsp)] = data
+}
+
+// Emit sends event with args to all the clients connected to the namespace
+// nsp.
+func (s *Server) Emit(nsp, event string, args ...interface{}) error {
+	data, err := json.Marshal(append([]interface{}{event}, args...))
+	if err != nil {
+		return err
+	}
+	nsp = namespace(nsp)
+	p := packet.Packet{Type: packet.Event, Id: -1, Data: data}
+	if nsp != "/" {
+		p.NSP = nsp
+	}
+	s.lock.Lock()
+	var sockets []*socket
+	for so := range s.sockets {
+		if nsp == "/" || so.joined(nsp) {
+			sockets = append(sockets, so)
+		}
+	}
+	s.lock.Unlock()
+	for _, so := range sockets {
+		if err := so.write(p, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns the events received so far, in order.
+func (s *Server) Events() []Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.engine.Accept()
+		if err != nil {
+			return
+		}
+		so := &socket{conn: conn, nsps: make(map[string]bool)}
+		s.lock.Lock()
+		s.sockets[so] = true
+		s.lock.Unlock()
+		go s.serve(so)
+	}
+}
+
+func (s *Server) serve(so *socket) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.sockets, so)
+		s.lock.Unlock()
+		so.conn.Close()
+	}()
+	// the default namespace is joined on open
+	if err := so.write(packet.Packet{Type: packet.Connect, Id: -1}, nil); err != nil {
+		return
+	}
+	// a binary event waiting for its attachments
+	var (
+		pending     *packet.Packet
+		attachments [][]byte
+	)
+	for {
+		t, r, err := so.conn.NextReader()
+		if err != nil {
+			return
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return
+		}
+		if t != engineio.MessageText {
+			if pending == nil {
+				continue
+			}
+			attachments = append(attachments, b)
+			if len(attachments) < pending.Attachments {
+				continue
+			}
+			err := s.handle(so, *pending, attachments)
+			pending, attachments = nil, nil
+			if err != nil {
+				return
+			}
+			continue
+		}
+		p, err := packet.Decode(b)
+		if err != nil {
+			continue
+		}
+		if p.Type.Binary() && p.Attachments > 0 {
+			pending = &p
+			continue
+		}
+		if err := s.handle(so, p, nil); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers the socket.io packet p, with its attachments when it is a
+// binary event.
+func (s *Server) handle(so *socket, p packet.Packet, attachments [][]byte) error {
+	nsp := namespace(p.NSP)
+	switch p.Type {
+	case packet.Connect:
+		if nsp == "/" {
+			return nil
+		}
+		s.lock.Lock()
+		reject, ok := s.rejects[nsp]
+		s.lock.Unlock()
+		if ok {
+			b, err := json.Marshal(reject)
+			if err != nil {
+				return err
+			}
+			return so.write(packet.Packet{Type: packet.Error, NSP: p.NSP, Id: -1, Data: b}, nil)
+		}
+		so.join(nsp)
+		return so.write(packet.Packet{Type: packet.Connect, NSP: p.NSP, Id: -1}, nil)
+	case packet.Disconnect:
+		so.leave(nsp)
+		return nil
+	case packet.Event, packet.BinaryEvent:
+		var args []json.RawMessage
+		if err := json.Unmarshal(p.Data, &args); err != nil || len(args) == 0 {
+			return nil
+		}
+		var name string
+		if err := json.Unmarshal(args[0], &name); err != nil {
+			return nil
+		}
+		s.lock.Lock()
+		s.events = append(s.events, Event{
+			Namespace:   nsp,
+			Name:        name,
+			Args:        args[1:],
+			Attachments: attachments,
+		})
+		ack, scripted := s.acks[name]
+		s.lock.Unlock()
+
+		id := p.Id
+		p.Id = -1
+		if err := so.write(p, attachments); err != nil {
+			return err
+		}
+		if id < 0 {
+			return nil
+		}
+		if scripted {
+			b, err := json.Marshal(ack)
+			if err != nil {
+				return err
+			}
+			return so.write(packet.Packet{Type: packet.Ack, NSP: p.NSP, Id: id, Data: b}, nil)
+		}
+		b, _ := json.Marshal(args[1:])
+		if p.Type == packet.Event {
+			return so.write(packet.Packet{Type: packet.Ack, NSP: p.NSP, Id: id, Data: b}, nil)
+		}
+		return so.write(packet.Packet{
+			Type:        packet.BinaryAck,
+			NSP:         p.NSP,
+			Id:          id,
+			Attachments: p.Attachments,
+			Data:        b,
+		}, attachments)
+	}
+	return nil
+}
+
+func (so *socket) join(nsp string) {
+	so.lock.Lock()
+	defer so.lock.Unlock()
+	so.nsps[nsp] = true
+}
+
+func (so *socket) leave(nsp string) {
+	so.lock.Lock()
+	defer so.lock.Unlock()
+	delete(so.nsps, nsp)
+}
+
+func (so *socket) joined(nsp string) bool {
+	so.lock.Lock()
+	defer so.lock.Unlock()
+	return so.nsps[nsp]
+}
+
+// write sends the packet p followed by its attachments.
+func (so *socket) write(p packet.Packet, attachments [][]byte) error {
+	so.wlock.Lock()
+	defer so.wlock.Unlock()
+	if err := writeMessage(so.conn, engineio.MessageText, packet.Append(nil, p)); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if err := writeMessage(so.conn, engineio.MessageBinary, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMessage(conn engineio.Conn, t engineio.MessageType, b []byte) error {
+	w, err := conn.NextWriter(t)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// namespace returns nsp, "/" for the default namespace.
+func namespace(nsp string) string {
+	if nsp == "" {
+		return "/"
+	}
+	return nsp
+}
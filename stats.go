@@ -0,0 +1,106 @@
+package socketio_client
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats holds the cumulative counters of a client, see Client.Stats.
+type Stats struct {
+	Sent        DirectionStats
+	Received    DirectionStats
+	RateLimited uint64 //events received but dropped by Options.IncomingRateLimit
+}
+
+// DirectionStats counts the packets going one way.
+type DirectionStats struct {
+	Packets uint64
+	Bytes   uint64                //text and binary frames of the packets
+	Types   map[PacketType]uint64 //packets by type
+	Events  map[string]uint64     //event packets by event name
+}
+
+const (
+	statsSent = iota
+	statsReceived
+)
+
+// statsCounters are updated atomically on every packet; the event name
+// counters are created on first use.
+type statsCounters struct {
+	packets [2][_BINARY_ACK + 1]uint64
+	bytes   [2]uint64
+	events  [2]sync.Map // event name -> *uint64
+
+	rateLimited uint64
+}
+
+func (s *statsCounters) count(direction int, t PacketType, event string, size int) {
+	if t >= 0 && t <= _BINARY_ACK {
+		atomic.AddUint64(&s.packets[direction][t], 1)
+	}
+	atomic.AddUint64(&s.bytes[direction], uint64(size))
+	if event == "" {
+		return
+	}
+	n, ok := s.events[direction].Load(event)
+	if !ok {
+		n, _ = s.events[direction].LoadOrStore(event, new(uint64))
+	}
+	atomic.AddUint64(n.(*uint64), 1)
+}
+
+func (s *statsCounters) snapshot(direction int) DirectionStats {
+	ret := DirectionStats{
+		Bytes:  atomic.LoadUint64(&s.bytes[direction]),
+		Types:  make(map[PacketType]uint64),
+		Events: make(map[string]uint64),
+	}
+	for t := range s.packets[direction] {
+		if n := atomic.LoadUint64(&s.packets[direction][t]); n > 0 {
+			ret.Types[PacketType(t)] = n
+			ret.Packets += n
+		}
+	}
+	s.events[direction].Range(func(k, v interface{}) bool {
+		ret.Events[k.(string)] = atomic.LoadUint64(v.(*uint64))
+		return true
+	})
+	return ret
+}
+
+// Stats returns the packets and bytes sent and received by the client
+// since it was created, per packet type and per event name.
+func (client *Client) Stats() Stats {
+	return Stats{
+		Sent:        client.stats.snapshot(statsSent),
+		Received:    client.stats.snapshot(statsReceived),
+		RateLimited: atomic.LoadUint64(&client.stats.rateLimited),
+	}
+}
+
+// countingWriter counts the bytes of the frames written through it.
+type countingWriter struct {
+	frameWriter
+	n int
+}
+
+func (w *countingWriter) NextWriter(t MessageType) (io.WriteCloser, error) {
+	fw, err := w.frameWriter.NextWriter(t)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFrame{WriteCloser: fw, n: &w.n}, nil
+}
+
+type countingFrame struct {
+	io.WriteCloser
+	n *int
+}
+
+func (f *countingFrame) Write(p []byte) (int, error) {
+	n, err := f.WriteCloser.Write(p)
+	*f.n += n
+	return n, err
+}
@@ -0,0 +1,86 @@
+package socketio_client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// caBundle is a PEM file of root CAs as last read.
+type caBundle struct {
+	modTime time.Time
+	size    int64
+	pool    *x509.CertPool
+}
+
+var (
+	caBundlesLock sync.Mutex
+	caBundles     = map[string]*caBundle{}
+)
+
+// loadRootCAs returns the root CAs of the PEM file at path, read again
+// whenever it changed since the last connection.
+func loadRootCAs(path string) (*x509.CertPool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("root CAs: %w", err)
+	}
+	caBundlesLock.Lock()
+	defer caBundlesLock.Unlock()
+	if b := caBundles[path]; b != nil && b.modTime.Equal(info.ModTime()) && b.size == info.Size() {
+		return b.pool, nil
+	}
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("root CAs: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("root CAs %s: no PEM certificate", path)
+	}
+	caBundles[path] = &caBundle{modTime: info.ModTime(), size: info.Size(), pool: pool}
+	return pool, nil
+}
+
+// optionsTLS returns the TLS settings of the built-in transports, nil to
+// keep the default ones.
+func optionsTLS(opts *Options) (*tls.Config, error) {
+	if opts.TLSConfig == nil && opts.ServerName == "" && opts.RootCAs == nil && opts.RootCAsFile == "" && !opts.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if opts.TLSConfig != nil {
+		config = opts.TLSConfig.Clone()
+	}
+	if opts.ServerName != "" {
+		config.ServerName = opts.ServerName
+	}
+	if opts.RootCAs != nil {
+		config.RootCAs = opts.RootCAs
+	}
+	if opts.RootCAsFile != "" {
+		pool, err := loadRootCAs(opts.RootCAsFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if opts.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// warnInsecure logs that the server certificate of u is not checked, to
+// the standard logger when log discards everything.
+func warnInsecure(log Logger, u *url.URL) {
+	if _, ok := log.(nopLogger); ok {
+		log = stdLogger{}
+	}
+	log.Errorf("engine.io %s: TLS certificates are NOT verified, Options.InsecureSkipVerify is set", redactURL(u))
+}
@@ -0,0 +1,19 @@
+package socketio_client
+
+import "fmt"
+
+// bearerToken returns the Authorization value carrying the token of
+// source, empty without a source or a token.
+func bearerToken(source func() (string, error)) (string, error) {
+	if source == nil {
+		return "", nil
+	}
+	token, err := source()
+	if err != nil {
+		return "", fmt.Errorf("token source: %w", err)
+	}
+	if token == "" {
+		return "", nil
+	}
+	return "Bearer " + token, nil
+}
@@ -0,0 +1,96 @@
+package socketio_client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// HandlerInfo describes an event handler invocation passed to
+// Options.TraceHandler.
+type HandlerInfo struct {
+	Context   context.Context //carried with the packet, see Packet.SetContext
+	Event     string
+	Namespace string
+	Size      int //payload bytes, attachments included
+
+	setContext func(ctx context.Context)
+}
+
+// SetContext replaces the context the handler gets, such as with the span
+// Options.TraceHandler started for it.
+func (info HandlerInfo) SetContext(ctx context.Context) {
+	if info.setContext != nil {
+		info.setContext(ctx)
+	}
+}
+
+// EmitInfo describes an emit passed to Options.TraceEmit.
+type EmitInfo struct {
+	Context   context.Context //of the caller, see Client.EmitContext
+	Event     string
+	Namespace string
+	Size      int  //JSON payload bytes, attachments excluded
+	Ack       bool //an ack callback was given
+
+	setContext func(ctx context.Context)
+}
+
+// SetContext replaces the context the packets of the emit carry, which the
+// outgoing middleware gets as Packet.Context, such as with the span
+// Options.TraceEmit started for it.
+func (info EmitInfo) SetContext(ctx context.Context) {
+	if info.setContext != nil {
+		info.setContext(ctx)
+	}
+}
+
+// WirePacket is a socket.io packet as sent or received on the connection,
+// passed to the Tracer. Its slices must not be modified.
+type WirePacket struct {
+	Outgoing    bool
+	Type        PacketType
+	Namespace   string
+	Payload     []byte   //the text frame
+	Attachments [][]byte //binary frames following it
+	Time        time.Time
+}
+
+// Tracer is given every packet of the connection, set it as
+// Options.Tracer to dump the wire conversation.
+type Tracer interface {
+	OnPacketSent(p WirePacket)
+	OnPacketReceived(p WirePacket)
+}
+
+// frameRecorder keeps a copy of the frames written through it.
+type frameRecorder struct {
+	frameWriter
+	frames [][]byte
+}
+
+func (r *frameRecorder) NextWriter(t MessageType) (io.WriteCloser, error) {
+	w, err := r.frameWriter.NextWriter(t)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingWriter{WriteCloser: w, recorder: r}, nil
+}
+
+type recordingWriter struct {
+	io.WriteCloser
+	recorder *frameRecorder
+	buf      bytes.Buffer
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.buf.Write(p[:n])
+	return n, err
+}
+
+func (w *recordingWriter) Close() error {
+	w.recorder.frames = append(w.recorder.frames, w.buf.Bytes())
+	return w.WriteCloser.Close()
+}
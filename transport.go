@@ -0,0 +1,132 @@
+package socketio_client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+type (
+	optionsKey struct{}
+	jarKey     struct{}
+)
+
+// withOptions attaches opts and the cookie jar of the connection to the
+// request handed to a transport creater, so the built-in transports can
+// apply per client settings.
+func withOptions(r *http.Request, opts *Options, jar http.CookieJar) *http.Request {
+	ctx := context.WithValue(r.Context(), optionsKey{}, opts)
+	if jar != nil {
+		ctx = context.WithValue(ctx, jarKey{}, jar)
+	}
+	return r.WithContext(ctx)
+}
+
+func requestOptions(r *http.Request) *Options {
+	if opts, ok := r.Context().Value(optionsKey{}).(*Options); ok && opts != nil {
+		return opts
+	}
+	return &Options{}
+}
+
+func requestJar(r *http.Request) http.CookieJar {
+	jar, _ := r.Context().Value(jarKey{}).(http.CookieJar)
+	return jar
+}
+
+// optionsDial returns the function dialing the TCP connections of the
+// built-in transports, nil to keep the default one.
+func optionsDial(opts *Options) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if opts.DialContext != nil {
+		return opts.DialContext
+	}
+	if opts.Dialer == nil && opts.Resolver == nil {
+		return nil
+	}
+	d := net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if opts.Dialer != nil {
+		d = *opts.Dialer
+	}
+	if opts.Resolver != nil {
+		d.Resolver = opts.Resolver
+	}
+	return d.DialContext
+}
+
+// sessionSetter is implemented by transports that carry the session id on
+// each request, once the handshake assigned it.
+type sessionSetter interface {
+	setSession(sid string)
+}
+
+// flusher is implemented by transports that hold back writes, so pending
+// packets can be sent before switching to another transport.
+type flusher interface {
+	Flush() error
+}
+
+// transportHeader returns the headers sent by the named transport: Header
+// with the keys of PollingHeader or WebsocketHeader replaced, and Origin.
+// Registered transports of other names send Header and Origin alone.
+func transportHeader(opts *Options, name string) http.Header {
+	var extra http.Header
+	switch name {
+	case "polling":
+		extra = opts.PollingHeader
+	case "websocket":
+		extra = opts.WebsocketHeader
+	}
+	header := make(http.Header, len(opts.Header)+len(extra))
+	for k, v := range opts.Header {
+		header[k] = v
+	}
+	for k, v := range extra {
+		header[k] = v
+	}
+	if opts.Origin != "" {
+		header.Set("Origin", opts.Origin)
+	}
+	return header
+}
+
+// affinityHeader returns the headers of resp named in names, which are
+// sent back on the requests that follow, nil when there is none.
+func affinityHeader(names []string, resp http.Header) http.Header {
+	var header http.Header
+	for _, name := range names {
+		if v := resp.Values(name); len(v) > 0 {
+			if header == nil {
+				header = make(http.Header, len(names))
+			}
+			header[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	return header
+}
+
+// statusError is returned by the built-in transports when the server
+// answers a request with an unexpected status.
+type statusError struct {
+	response *HandshakeResponse
+	err      error
+}
+
+func newStatusError(resp *http.Response, err error) *statusError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return &statusError{
+		response: newHandshakeResponse(resp, body),
+		err:      err,
+	}
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
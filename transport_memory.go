@@ -0,0 +1,234 @@
+package socketio_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+	"github.com/zhouhui8915/engine.io-go/transport"
+)
+
+var memoryCreater = transport.Creater{
+	Name:      "memory",
+	Upgrading: false,
+	Client:    newMemoryClient,
+}
+
+// memoryBuffer is how many frames wait each way for the other side to read
+// them before writes block.
+const memoryBuffer = 64
+
+// ErrMemoryClosed is returned by the reads and writes of a memory
+// connection once either side closed it.
+var ErrMemoryClosed = errors.New("memory connection closed")
+
+var (
+	memoryListenersLock sync.Mutex
+	memoryListeners     = map[string]*MemoryListener{}
+)
+
+// MemoryFrame is an engine.io packet carried by the "memory" transport,
+// such as "4hello" for a text message or "2" for a ping. The first byte of
+// a binary frame is the packet type as a number, 4 for a message.
+type MemoryFrame struct {
+	Binary bool
+	Data   []byte
+}
+
+// MemoryListener is the in-process peer of the "memory" transport, for
+// testing the protocol layer without sockets: a client with Transport
+// []string{"memory"} and the uri memory://name connects to the listener
+// of that name.
+type MemoryListener struct {
+	name  string
+	conns chan *MemoryConn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// ListenMemory returns the listener of the memory://name uris, failing when
+// another one has the name.
+func ListenMemory(name string) (*MemoryListener, error) {
+	memoryListenersLock.Lock()
+	defer memoryListenersLock.Unlock()
+	if _, ok := memoryListeners[name]; ok {
+		return nil, fmt.Errorf("memory listener %q already exists", name)
+	}
+	l := &MemoryListener{
+		name:  name,
+		conns: make(chan *MemoryConn),
+		done:  make(chan struct{}),
+	}
+	memoryListeners[name] = l
+	return l, nil
+}
+
+// Accept returns the next connection made to the listener.
+func (l *MemoryListener) Accept() (*MemoryConn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, ErrMemoryClosed
+	}
+}
+
+// Close stops the listener, freeing its name. Its connections stay open.
+func (l *MemoryListener) Close() error {
+	l.once.Do(func() {
+		memoryListenersLock.Lock()
+		delete(memoryListeners, l.name)
+		memoryListenersLock.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+// MemoryConn is the listener side of a connection of the memory transport,
+// which speaks engine.io with whole frames. It starts with Open.
+type MemoryConn struct {
+	request *http.Request
+	in      chan MemoryFrame //from the client
+	out     chan MemoryFrame //to the client
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Request returns the open request of the client, with its query and
+// headers.
+func (c *MemoryConn) Request() *http.Request {
+	return c.request
+}
+
+// Open sends the engine.io open packet giving the session id sid and the
+// settings of hs to the client.
+func (c *MemoryConn) Open(sid string, hs Handshake) error {
+	b, err := json.Marshal(openPacket{
+		Sid:          sid,
+		Upgrades:     hs.Upgrades,
+		PingInterval: hs.PingInterval.Milliseconds(),
+		PingTimeout:  hs.PingTimeout.Milliseconds(),
+		MaxPayload:   hs.MaxPayload,
+	})
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(MemoryFrame{Data: append([]byte("0"), b...)})
+}
+
+// ReadFrame returns the next frame sent by the client.
+func (c *MemoryConn) ReadFrame() (MemoryFrame, error) {
+	select {
+	case f := <-c.in:
+		return f, nil
+	case <-c.done:
+		return MemoryFrame{}, ErrMemoryClosed
+	}
+}
+
+// WriteFrame sends f to the client, waiting while 64 frames are unread.
+func (c *MemoryConn) WriteFrame(f MemoryFrame) error {
+	select {
+	case c.out <- f:
+		return nil
+	case <-c.done:
+		return ErrMemoryClosed
+	}
+}
+
+// Close ends the connection on both sides.
+func (c *MemoryConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+// memoryClient is the client side of a MemoryConn.
+type memoryClient struct {
+	conn *MemoryConn
+	resp *http.Response
+}
+
+func newMemoryClient(r *http.Request) (transport.Client, error) {
+	memoryListenersLock.Lock()
+	l := memoryListeners[r.URL.Host]
+	memoryListenersLock.Unlock()
+	if l == nil {
+		return nil, fmt.Errorf("no memory listener %q", r.URL.Host)
+	}
+	conn := &MemoryConn{
+		request: r,
+		in:      make(chan MemoryFrame, memoryBuffer),
+		out:     make(chan MemoryFrame, memoryBuffer),
+		done:    make(chan struct{}),
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		return nil, fmt.Errorf("memory listener %q: %w", r.URL.Host, ErrMemoryClosed)
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+	return &memoryClient{
+		conn: conn,
+		resp: &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Header:     make(http.Header),
+			Request:    r,
+		},
+	}, nil
+}
+
+func (c *memoryClient) Response() *http.Response {
+	return c.resp
+}
+
+func (c *memoryClient) NextReader() (*parser.PacketDecoder, error) {
+	select {
+	case f := <-c.conn.out:
+		return parser.NewDecoder(bytes.NewReader(f.Data))
+	case <-c.conn.done:
+		return nil, io.EOF
+	}
+}
+
+func (c *memoryClient) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	select {
+	case <-c.conn.done:
+		return nil, ErrMemoryClosed
+	default:
+	}
+	w := &memoryWriter{conn: c.conn, binary: msgType == message.MessageBinary}
+	if w.binary {
+		return parser.NewBinaryEncoder(w, packetType)
+	}
+	return parser.NewStringEncoder(w, packetType)
+}
+
+func (c *memoryClient) Close() error {
+	return c.conn.Close()
+}
+
+// memoryWriter sends what was written as one frame once closed.
+type memoryWriter struct {
+	bytes.Buffer
+	conn   *MemoryConn
+	binary bool
+}
+
+func (w *memoryWriter) Close() error {
+	select {
+	case w.conn.in <- MemoryFrame{Binary: w.binary, Data: w.Bytes()}:
+		return nil
+	case <-w.conn.done:
+		return ErrMemoryClosed
+	}
+}
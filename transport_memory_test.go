@@ -0,0 +1,75 @@
+package socketio_client
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var memoryServers int64
+
+// newMemoryServer serves clients of the memory transport on the uri it
+// returns, handing the frames to handle, when not nil, which reports
+// whether it answered them. Namespace connects left unanswered are
+// accepted.
+func newMemoryServer(t *testing.T, handle func(conn *MemoryConn, f MemoryFrame) bool) string {
+	t.Helper()
+	l, err := ListenMemory(fmt.Sprintf("test-%d", atomic.AddInt64(&memoryServers, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		lock  sync.Mutex
+		conns []*MemoryConn
+	)
+	t.Cleanup(func() {
+		l.Close()
+		lock.Lock()
+		defer lock.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			conns = append(conns, conn)
+			lock.Unlock()
+			go serveMemory(conn, handle)
+		}
+	}()
+	return "memory://" + l.name
+}
+
+func serveMemory(conn *MemoryConn, handle func(conn *MemoryConn, f MemoryFrame) bool) {
+	hs := Handshake{PingInterval: time.Minute, PingTimeout: time.Minute}
+	if conn.Open("sid", hs) != nil {
+		return
+	}
+	for {
+		f, err := conn.ReadFrame()
+		if err != nil {
+			return
+		}
+		if handle != nil && handle(conn, f) {
+			continue
+		}
+		if !f.Binary && bytes.HasPrefix(f.Data, []byte("40")) {
+			// connect acknowledged as it is
+			if conn.WriteFrame(f) != nil {
+				return
+			}
+		}
+	}
+}
+
+func memoryOptions() *Options {
+	return &Options{Transport: []string{"memory"}}
+}
@@ -0,0 +1,430 @@
+package socketio_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+	"github.com/zhouhui8915/engine.io-go/transport"
+)
+
+var pollingCreater = transport.Creater{
+	Name:      "polling",
+	Upgrading: false,
+	Client:    newPollingClient,
+}
+
+// pollingClient is the long-polling transport. Unlike the engine.io-go one it
+// can coalesce several packets into one POST, see Options.WriteCoalesce.
+// Either way a writer returns once the POST carrying its packet is answered,
+// with the error of that POST.
+type pollingClient struct {
+	req      http.Request
+	url      url.URL
+	client   *http.Client
+	coalesce time.Duration
+	opts     *Options         //for the labels of the coalescing goroutine
+	stamp    string           //query parameter of the cache-busting timestamp, empty for none
+	gzipMin  int              //POST bodies of at least this size are gzipped, 0 for never
+	timeouts [2]time.Duration //of the GET and POST requests, 0 for none
+	affinity []string         //response headers replayed on the next requests, see Options.AffinityHeaders
+	token    func() (string, error)
+	cancel   context.CancelFunc
+	seq      uint32
+
+	getResp        *http.Response
+	payloadDecoder *parser.PayloadDecoder
+	payloadEncoder *parser.PayloadEncoder
+
+	lock     sync.Mutex
+	resp     *http.Response
+	replay   http.Header //last values of the affinity headers
+	closed   bool
+	flush    *time.Timer
+	batch    *postBatch //packets waiting for the coalescing window
+	postLock sync.Mutex
+}
+
+func newPollingClient(r *http.Request) (transport.Client, error) {
+	opts := requestOptions(r)
+	u := *r.URL
+	if opts.ForceBase64 {
+		u.RawQuery = setQuery(u.RawQuery, "b64", "1")
+	}
+	newEncoder := parser.NewBinaryPayloadEncoder
+	if _, ok := u.Query()["b64"]; ok {
+		newEncoder = parser.NewStringPayloadEncoder
+	}
+	client := &http.Client{Jar: requestJar(r), CheckRedirect: checkRedirect(opts.Redirect)}
+	tlsConfig, err := optionsTLS(opts)
+	if err != nil {
+		return nil, err
+	}
+	dial := optionsDial(opts)
+	if dial != nil || tlsConfig != nil || opts.HTTP2 != HTTP2Auto {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if dial != nil {
+			t.DialContext = dial
+		}
+		t.TLSClientConfig = tlsConfig
+		if err := setHTTP2(t, opts.HTTP2); err != nil {
+			return nil, err
+		}
+		client.Transport = t
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	req := r.WithContext(ctx)
+	if opts.Host != "" {
+		req.Host = opts.Host
+	}
+	ret := &pollingClient{
+		req:            *req,
+		url:            u,
+		client:         client,
+		coalesce:       opts.WriteCoalesce,
+		opts:           opts,
+		stamp:          opts.TimestampParam,
+		gzipMin:        opts.GzipThreshold,
+		timeouts:       [2]time.Duration{opts.ReadTimeout, opts.WriteTimeout},
+		affinity:       opts.AffinityHeaders,
+		token:          opts.TokenSource,
+		cancel:         cancel,
+		payloadEncoder: newEncoder(),
+	}
+	if ret.stamp == "" {
+		ret.stamp = "t"
+	}
+	if opts.DisableTimestamps {
+		ret.stamp = ""
+	}
+	return ret, nil
+}
+
+func (c *pollingClient) Response() *http.Response {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.resp
+}
+
+func (c *pollingClient) NextReader() (*parser.PacketDecoder, error) {
+	if c.isClosed() {
+		return nil, io.EOF
+	}
+	if c.payloadDecoder != nil {
+		ret, err := c.payloadDecoder.Next()
+		if err != io.EOF {
+			return ret, err
+		}
+		c.getResp.Body.Close()
+		c.payloadDecoder = nil
+	}
+	for {
+		resp, err := c.do("GET", nil, "")
+		if err != nil {
+			return nil, err
+		}
+		c.getResp = resp
+		c.payloadDecoder = parser.NewPayloadDecoder(resp.Body)
+		ret, err := c.payloadDecoder.Next()
+		if err != io.EOF || c.isClosed() {
+			return ret, err
+		}
+		// some servers end a poll with an empty payload rather than a noop
+		resp.Body.Close()
+		c.payloadDecoder = nil
+	}
+}
+
+func (c *pollingClient) NextWriter(messageType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	if c.isClosed() {
+		return nil, io.EOF
+	}
+	next := c.payloadEncoder.NextBinary
+	if messageType == message.MessageText {
+		next = c.payloadEncoder.NextString
+	}
+	w, err := next(packetType)
+	if err != nil {
+		return nil, err
+	}
+	return &pollingWriter{
+		WriteCloser: w,
+		client:      c,
+	}, nil
+}
+
+func (c *pollingClient) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.lock.Unlock()
+
+	c.Flush()
+
+	c.lock.Lock()
+	c.closed = true
+	c.lock.Unlock()
+	c.cancel()
+	if c.client.Transport != nil {
+		// the transport is not shared with other clients
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Flush sends the packets still waiting for the coalescing window and
+// waits for a post already in flight.
+func (c *pollingClient) Flush() error {
+	return c.post()
+}
+
+func (c *pollingClient) setSession(sid string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.url.RawQuery = setQuery(c.url.RawQuery, "sid", sid)
+}
+
+func (c *pollingClient) isClosed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+// postBatch is the outcome of a coalesced POST, shared by the writers of
+// the packets it carries.
+type postBatch struct {
+	done chan struct{}
+	err  error
+}
+
+func (b *postBatch) wait() error {
+	<-b.done
+	return b.err
+}
+
+func (c *pollingClient) post() error {
+	c.postLock.Lock()
+	defer c.postLock.Unlock()
+
+	// the packets closed until now are in this POST, and so are their
+	// writers waiting for it
+	buf := bytes.NewBuffer(nil)
+	c.lock.Lock()
+	batch := c.batch
+	c.batch = nil
+	if c.flush != nil {
+		c.flush.Stop()
+		c.flush = nil
+	}
+	err := c.payloadEncoder.EncodeTo(buf)
+	c.lock.Unlock()
+	if err == nil {
+		err = c.send(buf)
+	}
+	if batch != nil {
+		batch.err = err
+		close(batch.done)
+	}
+	return err
+}
+
+// send POSTs the encoded packets of buf.
+func (c *pollingClient) send(buf *bytes.Buffer) error {
+	if buf.Len() == 0 {
+		return nil
+	}
+	var body io.Reader = buf
+	encoding := ""
+	if c.gzipMin > 0 && buf.Len() >= c.gzipMin {
+		zbuf := bytes.NewBuffer(nil)
+		zw := gzip.NewWriter(zbuf)
+		zw.Write(buf.Bytes())
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body, encoding = zbuf, "gzip"
+	}
+	resp, err := c.do("POST", body, encoding)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+func (c *pollingClient) do(method string, body io.Reader, encoding string) (*http.Response, error) {
+	if c.isClosed() {
+		return nil, io.EOF
+	}
+	auth, err := bearerToken(c.token)
+	if err != nil {
+		return nil, err
+	}
+	req := c.req
+	c.lock.Lock()
+	u := c.url
+	c.lock.Unlock()
+	req.URL = &u
+	req.Method = method
+	timeout := c.timeouts[0]
+	if method == "POST" {
+		timeout = c.timeouts[1]
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = *req.WithContext(ctx)
+	}
+	if c.stamp != "" {
+		t := fmt.Sprintf("%d-%d", time.Now().Unix()*1000, atomic.AddUint32(&c.seq, 1)-1)
+		req.URL.RawQuery = setQuery(req.URL.RawQuery, c.stamp, t)
+	}
+	if body != nil {
+		req.Body = ioutil.NopCloser(body)
+	}
+	// asking for gzip explicitly turns off the decompression of net/http,
+	// which would otherwise be skipped whenever Header sets Accept-Encoding
+	req.Header = req.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	c.lock.Lock()
+	for k, v := range c.replay {
+		req.Header[k] = v
+	}
+	c.lock.Unlock()
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := c.client.Do(&req)
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+	if cancel != nil {
+		// the timeout covers reading the body too
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		resp.Body = &gzipBody{body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.ContentLength = -1
+	}
+	c.lock.Lock()
+	if c.resp == nil {
+		c.resp = resp
+	}
+	if moved := movedURL(resp); moved != nil {
+		// the next requests go straight to where the server moved
+		moveTo(&c.url, moved)
+	}
+	if replay := affinityHeader(c.affinity, resp.Header); len(replay) > 0 {
+		if c.replay == nil {
+			c.replay = make(http.Header)
+		}
+		for k, v := range replay {
+			c.replay[k] = v
+		}
+	}
+	c.lock.Unlock()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, fmt.Errorf("polling %s: unexpected status %s", method, resp.Status))
+	}
+	return resp, nil
+}
+
+// cancelBody releases the context of its request once closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// gzipBody decompresses a response body on first read, so that an empty
+// body reads as EOF.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
+
+type pollingWriter struct {
+	io.WriteCloser
+	client *pollingClient
+}
+
+func (w *pollingWriter) Close() error {
+	wait, err := w.closeWait()
+	if err != nil {
+		return err
+	}
+	return wait()
+}
+
+// closeWait queues the packet and returns how to wait for the POST carrying
+// it. Without a coalescing window the packet is posted right away.
+func (w *pollingWriter) closeWait() (func() error, error) {
+	c := w.client
+	if c.coalesce <= 0 {
+		if err := w.WriteCloser.Close(); err != nil {
+			return nil, err
+		}
+		return noWait, c.post()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil, io.EOF
+	}
+	if err := w.WriteCloser.Close(); err != nil {
+		return nil, err
+	}
+	if c.batch == nil {
+		c.batch = &postBatch{done: make(chan struct{})}
+		c.flush = time.AfterFunc(c.coalesce, labeled(c.opts, func() { c.post() }, "writeCoalesce"))
+	}
+	return c.batch.wait, nil
+}
@@ -0,0 +1,165 @@
+package socketio_client
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+)
+
+// pollingServer answers the POSTs of a polling transport with its status,
+// keeping the packets of each.
+type pollingServer struct {
+	lock      sync.Mutex
+	status    int
+	posts     [][]string
+	encodings []string
+}
+
+func newPollingServer(t *testing.T) (*pollingServer, string) {
+	s := &pollingServer{status: http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			<-r.Context().Done()
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		var packets []string
+		dec := parser.NewPayloadDecoder(body)
+		for {
+			p, err := dec.Next()
+			if err != nil {
+				break
+			}
+			b, _ := ioutil.ReadAll(p)
+			packets = append(packets, string(b))
+		}
+		s.lock.Lock()
+		s.posts = append(s.posts, packets)
+		s.encodings = append(s.encodings, r.Header.Get("Content-Encoding"))
+		status := s.status
+		s.lock.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+func (s *pollingServer) setStatus(status int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status = status
+}
+
+func (s *pollingServer) received() ([][]string, []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([][]string(nil), s.posts...), append([]string(nil), s.encodings...)
+}
+
+func newTestPolling(t *testing.T, uri string, opts *Options) *pollingClient {
+	r, err := http.NewRequest("GET", uri+"/socket.io/?EIO=3&transport=polling", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newPollingClient(withOptions(r, opts, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c.(*pollingClient)
+}
+
+// writePackets writes the packets from a goroutine each, as clientConn
+// does, returning the error of each writer.
+func writePackets(c *pollingClient, packets ...string) []error {
+	var (
+		locker sync.Mutex
+		wg     sync.WaitGroup
+	)
+	errs := make([]error, len(packets))
+	for i, p := range packets {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			locker.Lock()
+			w, err := c.NextWriter(message.MessageText, parser.MESSAGE)
+			if err != nil {
+				locker.Unlock()
+				errs[i] = err
+				return
+			}
+			cw := newConnWriter(w, &locker)
+			io.WriteString(cw, p)
+			errs[i] = cw.Close()
+		}(i, p)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestPollingCoalescesWriters(t *testing.T) {
+	srv, uri := newPollingServer(t)
+	c := newTestPolling(t, uri, &Options{WriteCoalesce: 100 * time.Millisecond})
+
+	for i, err := range writePackets(c, "a", "b", "c") {
+		if err != nil {
+			t.Errorf("writer %d: %v", i, err)
+		}
+	}
+	posts, _ := srv.received()
+	if len(posts) != 1 || len(posts[0]) != 3 {
+		t.Fatalf("posts %q, want the 3 packets in one", posts)
+	}
+}
+
+func TestPollingPostErrorToItsWriters(t *testing.T) {
+	for _, coalesce := range []time.Duration{0, 50 * time.Millisecond} {
+		srv, uri := newPollingServer(t)
+		c := newTestPolling(t, uri, &Options{WriteCoalesce: coalesce})
+
+		srv.setStatus(http.StatusInternalServerError)
+		for i, err := range writePackets(c, "a", "b") {
+			if err == nil || !strings.Contains(err.Error(), "500") {
+				t.Errorf("coalesce %v: writer %d: %v, want the error of its POST", coalesce, i, err)
+			}
+		}
+		srv.setStatus(http.StatusOK)
+		if errs := writePackets(c, "c"); errs[0] != nil {
+			t.Errorf("coalesce %v: next writer: %v, want nil", coalesce, errs[0])
+		}
+	}
+}
+
+func TestPollingGzipThreshold(t *testing.T) {
+	srv, uri := newPollingServer(t)
+	c := newTestPolling(t, uri, &Options{GzipThreshold: 64})
+
+	long := strings.Repeat("x", 100)
+	writePackets(c, "short")
+	writePackets(c, long)
+	posts, encodings := srv.received()
+	if len(posts) != 2 || posts[0][0] != "short" || posts[1][0] != long {
+		t.Fatalf("posts %q", posts)
+	}
+	if encodings[0] != "" || encodings[1] != "gzip" {
+		t.Errorf("encodings %q, want only the long POST gzipped", encodings)
+	}
+}
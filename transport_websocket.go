@@ -0,0 +1,263 @@
+package socketio_client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+	"github.com/zhouhui8915/engine.io-go/transport"
+)
+
+var websocketCreater = transport.Creater{
+	Name:      "websocket",
+	Upgrading: true,
+	Client:    newWebsocketClient,
+}
+
+// Compression configures permessage-deflate on the websocket transport.
+// It is only used when the server accepts the extension.
+type Compression struct {
+	Level     int //flate level from -2 to 9, the gorilla/websocket default when 0
+	Threshold int //messages shorter than this many bytes are sent uncompressed; 0 compresses all
+}
+
+type websocketClient struct {
+	conn         *websocket.Conn
+	resp         *http.Response
+	compression  *Compression
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func newWebsocketClient(r *http.Request) (transport.Client, error) {
+	opts := requestOptions(r)
+	dialer := *websocket.DefaultDialer
+	dialer.Jar = requestJar(r)
+	dialer.EnableCompression = opts.Compression != nil
+	tlsConfig, err := optionsTLS(opts)
+	if err != nil {
+		return nil, err
+	}
+	dialer.TLSClientConfig = tlsConfig
+	if opts.ConnectTimeout > 0 {
+		// the dialer only watches the context until the TCP connection is up
+		dialer.HandshakeTimeout = opts.ConnectTimeout
+	}
+	dialer.NetDialContext = optionsDial(opts)
+	if delay := opts.WriteCoalesce; delay > 0 {
+		dial := dialer.NetDialContext
+		if dial == nil {
+			dial = new(net.Dialer).DialContext
+		}
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return newCoalescingConn(conn, delay, opts), nil
+		}
+	}
+
+	header := r.Header
+	auth, err := bearerToken(opts.TokenSource)
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" || opts.Host != "" {
+		header = header.Clone()
+	}
+	if auth != "" {
+		header.Set("Authorization", auth)
+	}
+	if opts.Host != "" {
+		// gorilla/websocket takes the Host header for the request host
+		header.Set("Host", opts.Host)
+	}
+
+	conn, resp, err := dialer.DialContext(r.Context(), r.URL.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, newStatusError(resp, err)
+		}
+		return nil, err
+	}
+
+	if c := opts.Compression; c != nil && c.Level != 0 {
+		if err := conn.SetCompressionLevel(c.Level); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return &websocketClient{
+		conn:         conn,
+		resp:         resp,
+		compression:  opts.Compression,
+		readTimeout:  opts.ReadTimeout,
+		writeTimeout: opts.WriteTimeout,
+	}, nil
+}
+
+func (c *websocketClient) Response() *http.Response {
+	return c.resp
+}
+
+func (c *websocketClient) NextReader() (*parser.PacketDecoder, error) {
+	for {
+		if c.readTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+		t, r, err := c.conn.NextReader()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case websocket.TextMessage, websocket.BinaryMessage:
+			return parser.NewDecoder(r)
+		}
+	}
+}
+
+func (c *websocketClient) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	wsType, newEncoder := websocket.TextMessage, parser.NewStringEncoder
+	if msgType == message.MessageBinary {
+		wsType, newEncoder = websocket.BinaryMessage, parser.NewBinaryEncoder
+	}
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	if c.compression != nil && c.compression.Threshold > 0 {
+		// the size is only known once the packet is written
+		return newEncoder(&thresholdWriter{client: c, messageType: wsType}, packetType)
+	}
+
+	w, err := c.conn.NextWriter(wsType)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(w, packetType)
+}
+
+func (c *websocketClient) Close() error {
+	return c.conn.Close()
+}
+
+// thresholdWriter buffers a message and compresses it on Close when it
+// reaches the compression threshold.
+type thresholdWriter struct {
+	bytes.Buffer
+	client      *websocketClient
+	messageType int
+}
+
+func (w *thresholdWriter) Close() error {
+	w.client.conn.EnableWriteCompression(w.Len() >= w.client.compression.Threshold)
+	return w.client.conn.WriteMessage(w.messageType, w.Bytes())
+}
+
+// coalesceMax is how many bytes a coalescing window holds before they are
+// written without waiting for its end, so that large bursts are neither
+// buffered whole nor delayed.
+const coalesceMax = 64 << 10
+
+// coalescingConn holds writes for a short delay so that frames written in
+// a burst reach the socket in one syscall. Each engine.io packet is still a
+// frame of its own, as the protocol has no way to batch them over a
+// websocket.
+type coalescingConn struct {
+	net.Conn
+	delay   time.Duration
+	timeout time.Duration //Options.WriteTimeout, applied to each flush
+	opts    *Options      //for the labels of the flushing goroutine
+
+	lock  sync.Mutex
+	buf   bytes.Buffer
+	timer *time.Timer
+	err   error
+}
+
+func newCoalescingConn(conn net.Conn, delay time.Duration, opts *Options) *coalescingConn {
+	return &coalescingConn{
+		Conn:    conn,
+		delay:   delay,
+		timeout: opts.WriteTimeout,
+		opts:    opts,
+	}
+}
+
+// Write buffers p until the end of the window. The write filling the buffer
+// up to coalesceMax flushes it and gets the error of that flush.
+func (c *coalescingConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.buf.Write(p)
+	if c.buf.Len() >= coalesceMax {
+		if c.timer != nil {
+			c.timer.Stop()
+			c.timer = nil
+		}
+		if err := c.writeLocked(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.delay, labeled(c.opts, c.flush, "writeCoalesce"))
+	}
+	return len(p), nil
+}
+
+// flush writes the pending bytes at the end of the window. The writes are
+// already done, so a failure closes the connection for the reader to report
+// it rather than waiting for the next write.
+func (c *coalescingConn) flush() {
+	c.lock.Lock()
+	c.timer = nil
+	err := c.writeLocked()
+	c.lock.Unlock()
+	if err != nil {
+		c.Conn.Close()
+	}
+}
+
+// writeLocked writes the pending bytes on the connection within the write
+// timeout, and keeps its error for the writes that follow.
+func (c *coalescingConn) writeLocked() error {
+	if c.err != nil || c.buf.Len() == 0 {
+		return c.err
+	}
+	if c.timeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	_, c.err = c.Conn.Write(c.buf.Bytes())
+	c.buf.Reset()
+	return c.err
+}
+
+// SetWriteDeadline is a no-op: the bytes reach the socket only once flushed,
+// under the deadline writeLocked sets.
+func (c *coalescingConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *coalescingConn) Close() error {
+	c.lock.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.writeLocked()
+	c.lock.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,209 @@
+package socketio_client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zhouhui8915/engine.io-go/message"
+	"github.com/zhouhui8915/engine.io-go/parser"
+)
+
+// newEchoWebsocket serves websocket connections echoing every message,
+// sending the Authorization header of the upgrade to auth.
+func newEchoWebsocket(t *testing.T, auth chan<- string) string {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			t, b, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(t, b); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestWebsocketEcho(t *testing.T) {
+	for _, coalesce := range []time.Duration{0, 10 * time.Millisecond} {
+		auth := make(chan string, 1)
+		uri := newEchoWebsocket(t, auth)
+		r, err := http.NewRequest("GET", uri+"/socket.io/?EIO=3&transport=websocket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := &Options{
+			WriteCoalesce: coalesce,
+			TokenSource:   func() (string, error) { return "secret", nil },
+		}
+		c, err := newWebsocketClient(withOptions(r, opts, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := <-auth; got != "Bearer secret" {
+			t.Errorf("coalesce %v: Authorization %q", coalesce, got)
+		}
+
+		for _, s := range []string{"one", "two"} {
+			w, err := c.NextWriter(message.MessageText, parser.MESSAGE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(s))
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, want := range []string{"one", "two"} {
+			dec, err := c.NextReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadAll(dec)
+			dec.Close()
+			if dec.Type() != parser.MESSAGE || string(b) != want {
+				t.Errorf("coalesce %v: read %v %q, want message %q", coalesce, dec.Type(), b, want)
+			}
+		}
+		c.Close()
+	}
+}
+
+// writesConn keeps the writes made on it.
+type writesConn struct {
+	net.Conn
+	lock   sync.Mutex
+	writes [][]byte
+}
+
+func (c *writesConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writes = append(c.writes, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (c *writesConn) Close() error {
+	return nil
+}
+
+func (c *writesConn) written() [][]byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([][]byte(nil), c.writes...)
+}
+
+func TestCoalescingConn(t *testing.T) {
+	conn := &writesConn{}
+	c := newCoalescingConn(conn, 20*time.Millisecond, &Options{})
+	c.Write([]byte("a"))
+	c.Write([]byte("b"))
+	if w := conn.written(); len(w) != 0 {
+		t.Fatalf("written %q before the end of the window", w)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(conn.written()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if w := conn.written(); len(w) != 1 || string(w[0]) != "ab" {
+		t.Fatalf("written %q, want \"ab\" at once", w)
+	}
+
+	// a full window is written without waiting
+	big := bytes.Repeat([]byte("x"), coalesceMax)
+	c.Write(big)
+	if w := conn.written(); len(w) != 2 || len(w[1]) != coalesceMax {
+		t.Fatalf("%d writes, want the full window written at once", len(w))
+	}
+	c.Write([]byte("c"))
+	c.Close()
+	if w := conn.written(); len(w) != 3 || string(w[2]) != "c" {
+		t.Fatalf("written %q, want Close to flush", w)
+	}
+}
+
+// failingConn fails its writes, keeping the deadline of the last one.
+type failingConn struct {
+	net.Conn
+	lock     sync.Mutex
+	deadline time.Time
+	written  time.Time
+	closed   bool
+}
+
+func (c *failingConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *failingConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.written = time.Now()
+	return 0, errTestWrite
+}
+
+func (c *failingConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	return nil
+}
+
+var errTestWrite = errors.New("write failed")
+
+func TestCoalescingConnErrors(t *testing.T) {
+	conn := &failingConn{}
+	c := newCoalescingConn(conn, 20*time.Millisecond, &Options{WriteTimeout: time.Second})
+	c.SetWriteDeadline(time.Now())
+	if _, err := c.Write([]byte("a")); err != nil {
+		t.Fatalf("Write: %v before the end of the window", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		conn.lock.Lock()
+		closed := conn.closed
+		conn.lock.Unlock()
+		if closed {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn.lock.Lock()
+	if !conn.closed {
+		t.Error("connection left open after a failed flush")
+	}
+	if d := conn.deadline.Sub(conn.written); d < time.Second/2 {
+		t.Errorf("flushed with a deadline %v away, want the write timeout", d)
+	}
+	conn.lock.Unlock()
+	if _, err := c.Write([]byte("b")); err != errTestWrite {
+		t.Errorf("Write after a failed flush: %v", err)
+	}
+
+	// the write filling the window gets the error of its flush
+	c = newCoalescingConn(&failingConn{}, time.Hour, &Options{})
+	if _, err := c.Write(bytes.Repeat([]byte("x"), coalesceMax)); err != errTestWrite {
+		t.Errorf("Write filling the window: %v", err)
+	}
+}
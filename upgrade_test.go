@@ -0,0 +1,74 @@
+package socketio_client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newSilentUpgradeServer serves polling sessions offering a websocket
+// upgrade whose probe is never answered.
+func newSilentUpgradeServer(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("transport") == "websocket":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		case r.Method == "POST":
+			io.WriteString(w, "ok")
+		case q.Get("sid") == "":
+			open := `0{"sid":"sid","upgrades":["websocket"],"pingInterval":60000,"pingTimeout":60000}`
+			fmt.Fprintf(w, "%d:%s", len(open), open)
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestUpgradeTimeout(t *testing.T) {
+	uri := newSilentUpgradeServer(t)
+	failed := make(chan error, 1)
+	start := time.Now()
+	client, err := NewClient(uri, &Options{
+		Transport:      []string{"polling", "websocket"},
+		UpgradeTimeout: 100 * time.Millisecond,
+		OnUpgradeError: func(err error) { failed <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrUpgradeFailed) {
+			t.Errorf("upgrade error %v, want ErrUpgradeFailed", err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("gave up the upgrade after %v", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the unanswered probe was not given up")
+	}
+	if got := client.CurrentTransport(); got != "polling" {
+		t.Errorf("transport %q, want polling", got)
+	}
+}